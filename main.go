@@ -5,16 +5,20 @@ import (
 	"google.golang.org/appengine"
 	"log"
 	"net/http"
+	"strings"
+
+	"stackdriver-monitoring-simple-reporter/pkg/period"
 	"stackdriver-monitoring-simple-reporter/pkg/service"
 )
 
 func main() {
 	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/cron/weekly-report-stuff", weeklyStuffJobHandler)
-	http.HandleFunc("/cron/weekly-report", weeklyReportJobHandler)
-	http.HandleFunc("/cron/monthly-report-stuff", monthlyStuffJobHandler)
-	http.HandleFunc("/cron/monthly-report", monthlyReportJobHandler)
+	for _, dataRange := range period.Ranges {
+		http.HandleFunc("/cron/"+dataRange+"-report-stuff", stuffJobHandler(dataRange))
+		http.HandleFunc("/cron/"+dataRange+"-report", reportJobHandler(dataRange))
+	}
 	http.HandleFunc("/export", exportMetricPointsHandler)
+	http.HandleFunc("/backfill", backfillHandler)
 
 	appengine.Main()
 }
@@ -31,10 +35,9 @@ Export Metric Points to CSV and PNG
 ************************************************/
 
 func exportMetricPointsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("%v, %v, %v, %v, %v, %v",
+	log.Printf("%v, %v, %v, %v, %v",
 		r.FormValue("projectID"),
 		r.FormValue("metric"),
-		r.FormValue("aligner"),
 		r.FormValue("filter"),
 		r.FormValue("instanceName"),
 		r.FormValue("dataRange"),
@@ -43,68 +46,111 @@ func exportMetricPointsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 	exportService := service.NewExportService(ctx)
 
+	// The interval the task was enqueued for, even when it runs late
 	dataRange := r.FormValue("dataRange")
-	exportService.SetDataRange(dataRange)
+	if err := exportService.SetDataRange(dataRange, r.FormValue("intervalStartTime"), r.FormValue("intervalEndTime")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	exportService.ExportStuff(
+	stats := exportService.ExportStuff(
 		r.FormValue("projectID"),
 		r.FormValue("metric"),
-		r.FormValue("aligner"),
 		r.FormValue("filter"),
 		r.FormValue("instanceName"),
 	)
+	exportService.ExportTaskDone(r.FormValue("projectID"), r.FormValue("run"), r.FormValue("task"), stats)
 
 	fmt.Fprint(w, "Done")
 }
 
+// The previous period by default, the one of ?start=2018-10-28 or an
+// explicit ?start=...&end=... interval otherwise. ?waitStuff=true holds the
+// report until the export tasks of the period are done.
+func setPeriod(w http.ResponseWriter, r *http.Request, exportService *service.ExportService, dataRange string) bool {
+	if err := exportService.SetDataRange(dataRange, r.FormValue("start"), r.FormValue("end")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	exportService.SkipExisting = r.FormValue("skipExisting") == "true"
+	exportService.WaitStuff = r.FormValue("waitStuff") == "true"
+	if r.FormValue("sendMail") == "false" {
+		exportService.SendMail = false
+	}
+
+	return true
+}
+
 /************************************************
 
-Weekly
+Report Jobs
 
 ************************************************/
 
-func weeklyStuffJobHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
+// e.g. /cron/daily-report-stuff, /cron/quarterly-report-stuff
+func stuffJobHandler(dataRange string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := appengine.NewContext(r)
 
-	exportService := service.NewExportService(ctx)
-	exportService.SetWeekly()
-	exportService.Do(ctx)
+		exportService := service.NewExportService(ctx)
+		if !setPeriod(w, r, exportService, dataRange) {
+			return
+		}
+		exportService.Do(ctx)
 
-	fmt.Fprint(w, "Weekly Job Done")
+		fmt.Fprintf(w, "%s Job Done", strings.Title(dataRange))
+	}
 }
 
-func weeklyReportJobHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-	exportService := service.NewExportService(ctx)
-	exportService.SetWeekly()
-
-	exportService.ExportWeeklyReport(ctx)
-
-	fmt.Fprint(w, "Done")
+// e.g. /cron/daily-report, /cron/quarterly-report
+func reportJobHandler(dataRange string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := appengine.NewContext(r)
+		exportService := service.NewExportService(ctx)
+		if !setPeriod(w, r, exportService, dataRange) {
+			return
+		}
+
+		// The task queue retries the report until the exports are done
+		if err := exportService.ExportReport(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprint(w, "Done")
+	}
 }
 
 /************************************************
 
-Monthly
+Backfill
 
 ************************************************/
 
-func monthlyStuffJobHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-
-	exportService := service.NewExportService(ctx)
-	exportService.SetMonthly()
-	exportService.Do(ctx)
-
-	fmt.Fprint(w, "Monthly Job Done")
+// App Engine strips these headers from outside requests, the admin one is
+// set by login: admin in app.yaml
+func fromAdmin(r *http.Request) bool {
+	return r.Header.Get("X-AppEngine-Cron") == "true" ||
+		r.Header.Get("X-AppEngine-QueueName") != "" ||
+		r.Header.Get("X-AppEngine-User-Is-Admin") == "1"
 }
 
-func monthlyReportJobHandler(w http.ResponseWriter, r *http.Request) {
+// e.g. /backfill?dataRange=monthly&start=2018-07-01&end=2018-10-01
+func backfillHandler(w http.ResponseWriter, r *http.Request) {
+	if !fromAdmin(r) {
+		http.Error(w, "Backfill is restricted to administrators", http.StatusForbidden)
+		return
+	}
+
 	ctx := appengine.NewContext(r)
 	exportService := service.NewExportService(ctx)
-	exportService.SetMonthly()
 
-	exportService.ExportMonthlyReport(ctx)
+	periods, err := exportService.Backfill(ctx, r.FormValue("dataRange"), r.FormValue("start"), r.FormValue("end"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	fmt.Fprint(w, "Done")
+	fmt.Fprintf(w, "Backfill %d period(s) enqueued", periods)
 }
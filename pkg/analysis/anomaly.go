@@ -0,0 +1,153 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	AnomalySpike      = "spike"
+	AnomalyDip        = "dip"
+	AnomalyLevelShift = "level shift"
+)
+
+// AnomalyOptions tune the detection. A point is a spike or a dip when its
+// robust z-score against the Window points before it is above Threshold. A
+// level shift is where the median of the ShiftWindow points after a point
+// moves away from the median of the ShiftWindow points before it by more than
+// ShiftThreshold robust deviations.
+type AnomalyOptions struct {
+	Window         int
+	Threshold      float64
+	ShiftWindow    int
+	ShiftThreshold float64
+}
+
+// Anomaly is a point of a series, Score is its robust z-score
+type Anomaly struct {
+	Time  time.Time
+	Value float64
+	Score float64
+	Kind  string
+}
+
+// MAD of normally distributed values times this is their standard deviation
+const madScale = 1.4826
+
+// DetectAnomalies finds the spikes, dips and level shifts of a series, in the
+// order of their time. Points which only follow a level shift until the
+// rolling baseline catches up are not spikes or dips. NaN values are left out.
+func DetectAnomalies(xValues []time.Time, yValues []float64, options AnomalyOptions) (anomalies []Anomaly) {
+	if len(xValues) != len(yValues) {
+		return
+	}
+	xValues, yValues = withValues(xValues, yValues)
+
+	var shifts []levelShift
+	if options.ShiftWindow > 0 {
+		shifts = levelShifts(yValues, options)
+	}
+
+	if options.Window > 0 {
+		for i := options.Window; i < len(yValues); i++ {
+			median, deviation := robustBaseline(yValues[i-options.Window : i])
+			if deviation == 0 {
+				continue
+			}
+
+			score := (yValues[i] - median) / deviation
+			if math.Abs(score) <= options.Threshold || followsShift(shifts, i, score, options) {
+				continue
+			}
+
+			kind := AnomalySpike
+			if score < 0 {
+				kind = AnomalyDip
+			}
+			anomalies = append(anomalies, Anomaly{Time: xValues[i], Value: yValues[i], Score: score, Kind: kind})
+		}
+	}
+
+	for _, shift := range shifts {
+		anomalies = append(anomalies, Anomaly{Time: xValues[shift.Index], Value: yValues[shift.Index], Score: shift.Score, Kind: AnomalyLevelShift})
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Time.Before(anomalies[j].Time)
+	})
+
+	return
+}
+
+type levelShift struct {
+	Index int
+	Score float64
+}
+
+// Within the windows around a shift in the same direction
+func followsShift(shifts []levelShift, i int, score float64, options AnomalyOptions) bool {
+	for _, shift := range shifts {
+		if i >= shift.Index-options.ShiftWindow && i < shift.Index+options.Window && (score > 0) == (shift.Score > 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Only the strongest point of consecutive shifted points is kept
+func levelShifts(yValues []float64, options AnomalyOptions) (shifts []levelShift) {
+	w := options.ShiftWindow
+	var best *levelShift
+
+	for i := w; i+w <= len(yValues); i++ {
+		before, beforeDeviation := robustBaseline(yValues[i-w : i])
+		after, afterDeviation := robustBaseline(yValues[i : i+w])
+		deviation := (beforeDeviation + afterDeviation) / 2
+
+		score := 0.0
+		if deviation > 0 {
+			score = (after - before) / deviation
+		}
+
+		if math.Abs(score) <= options.ShiftThreshold {
+			if best != nil {
+				shifts = append(shifts, *best)
+				best = nil
+			}
+			continue
+		}
+
+		if best == nil || math.Abs(score) > math.Abs(best.Score) {
+			best = &levelShift{Index: i, Score: score}
+		}
+	}
+	if best != nil {
+		shifts = append(shifts, *best)
+	}
+
+	return
+}
+
+// Median and scaled MAD of the values, the mean absolute deviation when more
+// than half of the values are equal
+func robustBaseline(values []float64) (median, deviation float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	median = Percentile(sorted, 50)
+
+	deviations := make([]float64, len(values))
+	var sum float64
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+		sum += deviations[i]
+	}
+	sort.Float64s(deviations)
+
+	deviation = Percentile(deviations, 50) * madScale
+	if deviation == 0 && len(values) > 0 {
+		deviation = sum / float64(len(values)) * math.Sqrt(math.Pi/2)
+	}
+
+	return
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// A noisy level of 30 points
+func noisy(level float64) []float64 {
+	noise := []float64{0, 1, -1, 0.5, -0.5, 0.2}
+	yValues := make([]float64, 30)
+	for i := range yValues {
+		yValues[i] = level + noise[i%len(noise)]
+	}
+
+	return yValues
+}
+
+func with(yValues []float64, at int, value float64) []float64 {
+	changed := append([]float64(nil), yValues...)
+	changed[at] = value
+	return changed
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	options := AnomalyOptions{Window: 6, Threshold: 4, ShiftWindow: 6, ShiftThreshold: 4}
+	nan := math.NaN()
+
+	gaps := with(with(with(noisy(10), 15, 30), 5, nan), 20, nan)
+	shift := append(noisy(10)[:15], noisy(30)[:15]...)
+
+	type found struct {
+		index int
+		kind  string
+	}
+	tests := []struct {
+		name    string
+		yValues []float64
+		expect  []found
+	}{
+		{"empty", nil, nil},
+		{"one point", []float64{10}, nil},
+		{"constant", make([]float64, 30), nil},
+		{"noise", noisy(10), nil},
+		{"spike", with(noisy(10), 15, 30), []found{{15, AnomalySpike}}},
+		{"dip", with(noisy(10), 15, -10), []found{{15, AnomalyDip}}},
+		{"NaN gaps", gaps, []found{{15, AnomalySpike}}},
+		{"level shift", shift, []found{{15, AnomalyLevelShift}}},
+	}
+
+	for _, test := range tests {
+		xValues, yValues := series(time.Hour, test.yValues...)
+		anomalies := DetectAnomalies(xValues, yValues, options)
+		if len(anomalies) != len(test.expect) {
+			t.Errorf("%s: expect %d anomalies, got %+v", test.name, len(test.expect), anomalies)
+			continue
+		}
+		for i, e := range test.expect {
+			if !anomalies[i].Time.Equal(xValues[e.index]) || anomalies[i].Kind != e.kind || anomalies[i].Value != yValues[e.index] {
+				t.Errorf("%s: expect a %s at %d, got %+v", test.name, e.kind, e.index, anomalies[i])
+			}
+		}
+	}
+}
+
+func TestRobustBaseline(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []float64
+		median    float64
+		deviation float64
+	}{
+		{"empty", nil, 0, 0},
+		{"one point", []float64{4}, 4, 0},
+		{"constant", []float64{4, 4, 4}, 4, 0},
+		{"MAD", []float64{1, 2, 3, 4, 100}, 3, 1 * madScale},
+		// More than half equal, the mean absolute deviation is used
+		{"mostly equal", []float64{5, 5, 5, 5, 9}, 5, 0.8 * math.Sqrt(math.Pi/2)},
+	}
+
+	for _, test := range tests {
+		median, deviation := robustBaseline(test.values)
+		if !near(median, test.median) || !near(deviation, test.deviation) {
+			t.Errorf("%s: expect %v and %v, got %v and %v", test.name, test.median, test.deviation, median, deviation)
+		}
+	}
+}
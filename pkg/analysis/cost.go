@@ -0,0 +1,48 @@
+package analysis
+
+import "time"
+
+// Cost of an instance in a period, amounts are in the currency of Hourly
+type Cost struct {
+	Hourly      float64
+	UptimeHours float64
+	Cost        float64
+	IdleHours   float64
+	IdleCost    float64
+	Savings     float64
+}
+
+// EstimateCost from the CPU usage of an instance in cores. Every point of the
+// series with a value is one step of uptime, idle when the utilization of the
+// vCPUs is below idleBelow. The alignment period is the step of a series too
+// short to tell its own. Keep is the share of the size a downsize keeps, 1
+// without one. The savings are the idle cost and what a downsize saves of
+// the rest.
+func EstimateCost(xValues []time.Time, yValues []float64, alignmentPeriod time.Duration, cpus int64, hourly, idleBelow, keep float64) (cost Cost) {
+	cost.Hourly = hourly
+
+	if len(xValues) != len(yValues) {
+		return
+	}
+
+	// NaN points still tell the step
+	step := Step(xValues)
+	if step == 0 {
+		step = alignmentPeriod
+	}
+	_, yValues = withValues(xValues, yValues)
+
+	stepHours := step.Hours()
+	for _, y := range yValues {
+		cost.UptimeHours += stepHours
+		if cpus > 0 && y/float64(cpus) < idleBelow {
+			cost.IdleHours += stepHours
+		}
+	}
+
+	cost.Cost = cost.UptimeHours * hourly
+	cost.IdleCost = cost.IdleHours * hourly
+	cost.Savings = cost.IdleCost + (cost.Cost-cost.IdleCost)*(1-keep)
+
+	return
+}
@@ -0,0 +1,43 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateCost(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name    string
+		step    time.Duration
+		yValues []float64
+		cpus    int64
+		keep    float64
+		expect  Cost
+	}{
+		{"empty", time.Hour, nil, 2, 1, Cost{Hourly: 0.1}},
+		{"one point", time.Hour, []float64{1}, 2, 1, Cost{Hourly: 0.1, UptimeHours: 1, Cost: 0.1}},
+		{"one idle point", 30 * time.Minute, []float64{0.1}, 2, 1, Cost{Hourly: 0.1, UptimeHours: 0.5, Cost: 0.05, IdleHours: 0.5, IdleCost: 0.05, Savings: 0.05}},
+		{"constant", time.Hour, []float64{1, 1, 1, 1}, 2, 1, Cost{Hourly: 0.1, UptimeHours: 4, Cost: 0.4}},
+		{"NaN gaps", time.Hour, []float64{1, nan, 0.1, nan}, 2, 1, Cost{Hourly: 0.1, UptimeHours: 2, Cost: 0.2, IdleHours: 1, IdleCost: 0.1, Savings: 0.1}},
+		{"downsize", time.Hour, []float64{0.1, 1, 1, 1}, 2, 0.5, Cost{Hourly: 0.1, UptimeHours: 4, Cost: 0.4, IdleHours: 1, IdleCost: 0.1, Savings: 0.25}},
+		{"no machine type", time.Hour, []float64{0, 0}, 0, 1, Cost{Hourly: 0.1, UptimeHours: 2, Cost: 0.2}},
+	}
+
+	for _, test := range tests {
+		xValues, yValues := series(time.Hour, test.yValues...)
+		cost := EstimateCost(xValues, yValues, test.step, test.cpus, 0.1, 0.1, test.keep)
+		e := test.expect
+		if !near(cost.Hourly, e.Hourly) || !near(cost.UptimeHours, e.UptimeHours) || !near(cost.Cost, e.Cost) ||
+			!near(cost.IdleHours, e.IdleHours) || !near(cost.IdleCost, e.IdleCost) || !near(cost.Savings, e.Savings) {
+			t.Errorf("%s: expect %+v, got %+v", test.name, e, cost)
+		}
+	}
+
+	// The points tell the step rather than the alignment period
+	xValues, yValues := series(5*time.Minute, 1, 1, 1)
+	if cost := EstimateCost(xValues, yValues, time.Hour, 2, 1, 0.1, 1); !near(cost.UptimeHours, 0.25) {
+		t.Errorf("expect 0.25 hours of uptime, got %v", cost.UptimeHours)
+	}
+}
@@ -0,0 +1,180 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	ForecastLinear      = "linear"
+	ForecastHoltWinters = "holtWinters"
+)
+
+// Smoothing of the level, trend and season of Holt-Winters
+const (
+	holtWintersAlpha = 0.3
+	holtWintersBeta  = 0.05
+	holtWintersGamma = 0.3
+)
+
+// Forecast is the projection of a series, one point every step after its
+// last point.
+type Forecast struct {
+	XValues []time.Time
+	YValues []float64
+}
+
+// Step of a series, the shortest interval between its points since the
+// points without a value are left out
+func Step(xValues []time.Time) (step time.Duration) {
+	for i := 1; i < len(xValues); i++ {
+		d := xValues[i].Sub(xValues[i-1])
+		if d > 0 && (step == 0 || d < step) {
+			step = d
+		}
+	}
+
+	return
+}
+
+// LinearForecast extends the trend line of the series by count steps, NaN
+// values are left out
+func LinearForecast(xValues []time.Time, yValues []float64, count int) (forecast Forecast, ok bool) {
+	if len(xValues) != len(yValues) {
+		return forecast, false
+	}
+
+	// NaN points still tell the step
+	step := Step(xValues)
+	xValues, yValues = withValues(xValues, yValues)
+	trend, ok := LinearTrend(xValues, yValues)
+	if !ok || step == 0 {
+		return forecast, false
+	}
+
+	last := xValues[len(xValues)-1]
+	for i := 1; i <= count; i++ {
+		at := last.Add(time.Duration(i) * step)
+		forecast.XValues = append(forecast.XValues, at)
+		forecast.YValues = append(forecast.YValues, trend.At(at))
+	}
+
+	return forecast, true
+}
+
+// HoltWintersForecast projects count steps with additive Holt-Winters and a
+// season of one day. Series shorter than two seasons fall back to the trend
+// line. NaN values are left out.
+func HoltWintersForecast(xValues []time.Time, yValues []float64, count int) (forecast Forecast, ok bool) {
+	if len(xValues) != len(yValues) {
+		return forecast, false
+	}
+
+	step := Step(xValues)
+	if step == 0 {
+		return forecast, false
+	}
+
+	season := int(24 * time.Hour / step)
+	if season < 2 || len(yValues) < 2*season {
+		return LinearForecast(xValues, yValues, count)
+	}
+	xValues, yValues = withValues(xValues, yValues)
+
+	// Slot of each point since the first, the points without a value are
+	// skipped over
+	slots := make([]int, len(xValues))
+	for i, x := range xValues {
+		slots[i] = int(x.Sub(xValues[0]) / step)
+	}
+
+	// The points of the first season set the level and the season, those of
+	// the second the trend
+	var first, second []float64
+	for i, slot := range slots {
+		switch slot / season {
+		case 0:
+			first = append(first, yValues[i])
+		case 1:
+			second = append(second, yValues[i])
+		}
+	}
+	if len(first) == 0 || len(second) == 0 {
+		return LinearForecast(xValues, yValues, count)
+	}
+
+	level := mean(first)
+	trend := (mean(second) - level) / float64(season)
+	// A slot without a value in the first season takes the one of the second
+	seasonal := make([]float64, season)
+	seen := make([]bool, season)
+	for i, slot := range slots {
+		switch {
+		case slot < season:
+			seasonal[slot] = yValues[i] - level
+			seen[slot] = true
+		case slot < 2*season && !seen[slot-season]:
+			seasonal[slot-season] = yValues[i] - level - trend*float64(season)
+		}
+	}
+
+	// The level is the one at the end of the first season
+	previous := season - 1
+	for i, slot := range slots {
+		if slot <= previous {
+			continue
+		}
+
+		s := seasonal[slot%season]
+		prior := level
+		level = holtWintersAlpha*(yValues[i]-s) + (1-holtWintersAlpha)*(level+trend*float64(slot-previous))
+		trend = holtWintersBeta*(level-prior)/float64(slot-previous) + (1-holtWintersBeta)*trend
+		seasonal[slot%season] = holtWintersGamma*(yValues[i]-level) + (1-holtWintersGamma)*s
+		previous = slot
+	}
+
+	for h := 1; h <= count; h++ {
+		forecast.XValues = append(forecast.XValues, xValues[0].Add(time.Duration(previous+h)*step))
+		forecast.YValues = append(forecast.YValues, level+float64(h)*trend+seasonal[(previous+h)%season])
+	}
+
+	return forecast, true
+}
+
+// Reach is the first projected time at or above the value
+func (f Forecast) Reach(value float64) (time.Time, bool) {
+	for i, y := range f.YValues {
+		if y >= value {
+			return f.XValues[i], true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Until keeps the projected points up to t
+func (f Forecast) Until(t time.Time) Forecast {
+	var until Forecast
+	for i, x := range f.XValues {
+		if x.After(t) {
+			break
+		}
+		until.XValues = append(until.XValues, x)
+		until.YValues = append(until.YValues, f.YValues[i])
+	}
+
+	return until
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStep(t *testing.T) {
+	at := func(minutes ...int) (xValues []time.Time) {
+		for _, m := range minutes {
+			xValues = append(xValues, origin.Add(time.Duration(m)*time.Minute))
+		}
+		return
+	}
+
+	tests := []struct {
+		name    string
+		xValues []time.Time
+		expect  time.Duration
+	}{
+		{"empty", nil, 0},
+		{"one point", at(0), 0},
+		{"regular", at(0, 5, 10), 5 * time.Minute},
+		{"gaps", at(0, 10, 15, 30), 5 * time.Minute},
+		{"same time", at(0, 0, 10), 10 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := Step(test.xValues); got != test.expect {
+			t.Errorf("%s: expect %v, got %v", test.name, test.expect, got)
+		}
+	}
+}
+
+func TestLinearForecast(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name    string
+		yValues []float64
+		ok      bool
+		expect  []float64
+	}{
+		{"empty", nil, false, nil},
+		{"one point", []float64{3}, false, nil},
+		{"constant", []float64{3, 3, 3, 3}, true, []float64{3, 3}},
+		{"line", []float64{0, 1, 2, 3}, true, []float64{4, 5}},
+		{"NaN gaps", []float64{0, nan, 2, 3, nan}, true, []float64{4, 5}},
+		{"every other NaN", []float64{0, nan, 2, nan, 4}, true, []float64{5, 6}},
+		{"only gaps", []float64{nan, nan, nan}, false, nil},
+	}
+
+	for _, test := range tests {
+		xValues, yValues := series(time.Hour, test.yValues...)
+		forecast, ok := LinearForecast(xValues, yValues, 2)
+		if ok != test.ok {
+			t.Errorf("%s: expect ok %v, got %v", test.name, test.ok, ok)
+			continue
+		}
+		if len(forecast.YValues) != len(test.expect) {
+			t.Errorf("%s: expect %v, got %v", test.name, test.expect, forecast.YValues)
+			continue
+		}
+		for i, y := range test.expect {
+			// The steps follow the last point with a value
+			at := origin.Add(time.Duration(len(test.yValues)+i) * time.Hour)
+			if math.IsNaN(test.yValues[len(test.yValues)-1]) {
+				at = at.Add(-time.Hour)
+			}
+			if !near(forecast.YValues[i], y) || !forecast.XValues[i].Equal(at) {
+				t.Errorf("%s: expect %v at %v, got %v at %v", test.name, y, at, forecast.YValues[i], forecast.XValues[i])
+			}
+		}
+	}
+}
+
+// Hourly points of days with a daily cycle around level
+func daily(days int, level, amplitude float64) []float64 {
+	yValues := make([]float64, days*24)
+	for i := range yValues {
+		yValues[i] = level + amplitude*math.Sin(2*math.Pi*float64(i)/24)
+	}
+
+	return yValues
+}
+
+func TestHoltWintersForecast(t *testing.T) {
+	seasonal := daily(4, 10, 5)
+	gaps := append([]float64(nil), seasonal...)
+	for _, i := range []int{3, 30, 50, 70} {
+		gaps[i] = math.NaN()
+	}
+
+	tests := []struct {
+		name      string
+		yValues   []float64
+		ok        bool
+		amplitude float64
+	}{
+		{"empty", nil, false, 0},
+		{"one point", []float64{3}, false, 0},
+		{"constant", daily(3, 10, 0), true, 0},
+		{"daily cycle", seasonal, true, 5},
+		{"NaN gaps", gaps, true, 5},
+	}
+
+	for _, test := range tests {
+		xValues, yValues := series(time.Hour, test.yValues...)
+		forecast, ok := HoltWintersForecast(xValues, yValues, 24)
+		if ok != test.ok {
+			t.Errorf("%s: expect ok %v, got %v", test.name, test.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if len(forecast.YValues) != 24 {
+			t.Fatalf("%s: expect 24 points, got %d", test.name, len(forecast.YValues))
+		}
+
+		// The cycle carries on
+		for i, y := range forecast.YValues {
+			h := len(test.yValues) + i
+			expect := 10 + test.amplitude*math.Sin(2*math.Pi*float64(h)/24)
+			if math.Abs(y-expect) > 0.5 || !forecast.XValues[i].Equal(origin.Add(time.Duration(h)*time.Hour)) {
+				t.Errorf("%s: expect %.2f at %d, got %.2f at %v", test.name, expect, h, y, forecast.XValues[i])
+			}
+		}
+	}
+
+	// Shorter than two seasons it is the trend line
+	xValues, yValues := series(time.Hour, 0, 1, 2, 3)
+	forecast, ok := HoltWintersForecast(xValues, yValues, 2)
+	if !ok || len(forecast.YValues) != 2 || !near(forecast.YValues[0], 4) || !near(forecast.YValues[1], 5) {
+		t.Errorf("expect the trend line 4, 5, got %v", forecast.YValues)
+	}
+}
+
+func TestReach(t *testing.T) {
+	xValues, yValues := series(time.Hour, 1, 2, 3, 4)
+	forecast := Forecast{XValues: xValues, YValues: yValues}
+
+	if at, ok := forecast.Reach(2.5); !ok || !at.Equal(xValues[2]) {
+		t.Errorf("expect %v, got %v %v", xValues[2], at, ok)
+	}
+	if _, ok := forecast.Reach(5); ok {
+		t.Errorf("expect 5 not to be reached")
+	}
+	if _, ok := (Forecast{}).Reach(0); ok {
+		t.Errorf("expect an empty forecast to reach nothing")
+	}
+	if until := forecast.Until(xValues[1]); len(until.XValues) != 2 {
+		t.Errorf("expect 2 points until %v, got %v", xValues[1], until.XValues)
+	}
+}
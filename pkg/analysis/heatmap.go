@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// Heatmap is the mean of series by day of the week and hour of the day, in
+// the location of their times. Rows start at WeekStart.
+type Heatmap struct {
+	WeekStart time.Weekday
+	Sums      [7][24]float64
+	Counts    [7][24]int
+}
+
+func NewHeatmap(weekStart time.Weekday) *Heatmap {
+	return &Heatmap{WeekStart: weekStart}
+}
+
+// Add the points of a series, the series added are pooled. NaN values are
+// left out.
+func (h *Heatmap) Add(xValues []time.Time, yValues []float64) {
+	for i := range xValues {
+		if i >= len(yValues) {
+			break
+		}
+		if math.IsNaN(yValues[i]) {
+			continue
+		}
+
+		row := (int(xValues[i].Weekday()) - int(h.WeekStart) + 7) % 7
+		h.Sums[row][xValues[i].Hour()] += yValues[i]
+		h.Counts[row][xValues[i].Hour()]++
+	}
+}
+
+// Merge pools the points of another heatmap
+func (h *Heatmap) Merge(other *Heatmap) {
+	for row := range h.Sums {
+		for hour := range h.Sums[row] {
+			h.Sums[row][hour] += other.Sums[row][hour]
+			h.Counts[row][hour] += other.Counts[row][hour]
+		}
+	}
+}
+
+// Weekday of a row
+func (h *Heatmap) Weekday(row int) time.Weekday {
+	return time.Weekday((int(h.WeekStart) + row) % 7)
+}
+
+// Mean of a cell, false without points
+func (h *Heatmap) Mean(row, hour int) (float64, bool) {
+	if h.Counts[row][hour] == 0 {
+		return 0, false
+	}
+
+	return h.Sums[row][hour] / float64(h.Counts[row][hour]), true
+}
+
+// Bounds are the lowest and highest cell means, false when every cell is
+// empty
+func (h *Heatmap) Bounds() (min, max float64, ok bool) {
+	for row := range h.Sums {
+		for hour := range h.Sums[row] {
+			mean, has := h.Mean(row, hour)
+			if !has {
+				continue
+			}
+
+			if !ok || mean < min {
+				min = mean
+			}
+			if !ok || mean > max {
+				max = mean
+			}
+			ok = true
+		}
+	}
+
+	return
+}
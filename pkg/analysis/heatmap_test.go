@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+type cell struct {
+	weekday time.Weekday
+	hour    int
+	mean    float64
+}
+
+func TestHeatmap(t *testing.T) {
+	nan := math.NaN()
+	tokyo := time.FixedZone("UTC+9", 9*3600)
+	// Monday 2018-10-01 00:00 UTC
+	monday := origin
+
+	tests := []struct {
+		name      string
+		weekStart time.Weekday
+		xValues   []time.Time
+		yValues   []float64
+		cells     []cell
+		min, max  float64
+	}{
+		{"empty", time.Sunday, nil, nil, nil, 0, 0},
+		{"one point", time.Sunday, []time.Time{monday.Add(13 * time.Hour)}, []float64{5}, []cell{{time.Monday, 13, 5}}, 5, 5},
+		{"constant", time.Monday, []time.Time{monday, monday.Add(time.Hour), monday.Add(7 * 24 * time.Hour)}, []float64{2, 2, 2}, []cell{{time.Monday, 0, 2}, {time.Monday, 1, 2}}, 2, 2},
+		{"pooled", time.Monday, []time.Time{monday.Add(10 * time.Minute), monday.Add(50 * time.Minute), monday.Add(7 * 24 * time.Hour)}, []float64{1, 2, 6}, []cell{{time.Monday, 0, 3}}, 3, 3},
+		{"NaN gaps", time.Sunday, []time.Time{monday, monday.Add(time.Hour), monday.Add(2 * time.Hour)}, []float64{1, nan, 3}, []cell{{time.Monday, 0, 1}, {time.Monday, 2, 3}}, 1, 3},
+		{"local time", time.Sunday, []time.Time{monday.Add(-time.Hour).In(tokyo)}, []float64{4}, []cell{{time.Monday, 8, 4}}, 4, 4},
+	}
+
+	for _, test := range tests {
+		h := NewHeatmap(test.weekStart)
+		h.Add(test.xValues, test.yValues)
+
+		filled := 0
+		for row := range h.Counts {
+			for hour := range h.Counts[row] {
+				if h.Counts[row][hour] > 0 {
+					filled++
+				}
+			}
+		}
+		if filled != len(test.cells) {
+			t.Errorf("%s: expect %d cells, got %d", test.name, len(test.cells), filled)
+		}
+		for _, c := range test.cells {
+			row := (int(c.weekday) - int(test.weekStart) + 7) % 7
+			if h.Weekday(row) != c.weekday {
+				t.Errorf("%s: expect row %d to be %v, got %v", test.name, row, c.weekday, h.Weekday(row))
+			}
+			if mean, ok := h.Mean(row, c.hour); !ok || !near(mean, c.mean) {
+				t.Errorf("%s: expect %v on %v at %d, got %v %v", test.name, c.mean, c.weekday, c.hour, mean, ok)
+			}
+		}
+
+		min, max, ok := h.Bounds()
+		if ok != (len(test.cells) > 0) || !near(min, test.min) || !near(max, test.max) {
+			t.Errorf("%s: expect bounds %v - %v, got %v - %v %v", test.name, test.min, test.max, min, max, ok)
+		}
+	}
+}
+
+func TestHeatmapMerge(t *testing.T) {
+	h := NewHeatmap(time.Monday)
+	h.Add([]time.Time{origin}, []float64{1})
+	other := NewHeatmap(time.Monday)
+	other.Add([]time.Time{origin, origin.Add(time.Hour)}, []float64{3, 5})
+
+	h.Merge(other)
+	if mean, _ := h.Mean(0, 0); !near(mean, 2) {
+		t.Errorf("expect 2, got %v", mean)
+	}
+	if mean, _ := h.Mean(0, 1); !near(mean, 5) {
+		t.Errorf("expect 5, got %v", mean)
+	}
+}
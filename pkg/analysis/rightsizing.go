@@ -0,0 +1,122 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	ActionDownsize = "downsize"
+	ActionUpsize   = "upsize"
+	ActionKeep     = "keep"
+)
+
+// Usage of one instance against the size of its machine type. CPU values are
+// in cores, memory values in bytes. HasCPU and HasMemory tell whether the
+// statistics were observed.
+type Usage struct {
+	CPUs      int64
+	MemoryMB  int64
+	CPU       Stats
+	Memory    Stats
+	HasCPU    bool
+	HasMemory bool
+}
+
+// Thresholds of the p95 utilization, 0.8 means 80% of the vCPUs or memory.
+// Suggested sizes put the p95 at Target.
+type Thresholds struct {
+	UpsizeAbove   float64
+	DownsizeBelow float64
+	Target        float64
+}
+
+// Recommendation is the action for one instance with its evidence.
+// Suggested sizes are the vCPUs and memory which put the p95 at the target.
+type Recommendation struct {
+	Action            string
+	CPUUtilization    float64
+	MemoryUtilization float64
+	SuggestedCPUs     int64
+	SuggestedMemoryMB int64
+	Reasons           []string
+}
+
+// Recommend upsizes when the CPU or memory p95 is above UpsizeAbove, and
+// downsizes when both are below DownsizeBelow and the suggested size is
+// smaller. Without memory data an instance is never downsized.
+func Recommend(usage Usage, thresholds Thresholds) (recommendation Recommendation) {
+	recommendation.Action = ActionKeep
+	recommendation.SuggestedCPUs = usage.CPUs
+	recommendation.SuggestedMemoryMB = usage.MemoryMB
+
+	if usage.CPUs <= 0 || usage.MemoryMB <= 0 || !usage.HasCPU {
+		recommendation.Reasons = []string{"no machine type or CPU data"}
+		return
+	}
+
+	recommendation.CPUUtilization = usage.CPU.P95 / float64(usage.CPUs)
+	cpuReason := fmt.Sprintf("CPU p95 %.2f of %d vCPUs (%.0f%%), mean %.2f", usage.CPU.P95, usage.CPUs, recommendation.CPUUtilization*100, usage.CPU.Mean)
+	recommendation.SuggestedCPUs = suggestedCPUs(usage.CPU.P95, thresholds.Target)
+
+	memoryBytes := float64(usage.MemoryMB) * 1024 * 1024
+	memoryReason := "no memory data, is the monitoring agent installed?"
+	if usage.HasMemory {
+		recommendation.MemoryUtilization = usage.Memory.P95 / memoryBytes
+		memoryReason = fmt.Sprintf("memory p95 %.1f of %.1f GB (%.0f%%)", usage.Memory.P95/1024/1024/1024, memoryBytes/1024/1024/1024, recommendation.MemoryUtilization*100)
+		recommendation.SuggestedMemoryMB = suggestedMemoryMB(usage.Memory.P95, thresholds.Target)
+	}
+	recommendation.Reasons = []string{cpuReason, memoryReason}
+
+	switch {
+	case recommendation.CPUUtilization > thresholds.UpsizeAbove || recommendation.MemoryUtilization > thresholds.UpsizeAbove:
+		recommendation.Action = ActionUpsize
+		recommendation.SuggestedCPUs = maxInt64(recommendation.SuggestedCPUs, usage.CPUs)
+		recommendation.SuggestedMemoryMB = maxInt64(recommendation.SuggestedMemoryMB, usage.MemoryMB)
+	case usage.HasMemory && recommendation.CPUUtilization < thresholds.DownsizeBelow && recommendation.MemoryUtilization < thresholds.DownsizeBelow &&
+		(recommendation.SuggestedCPUs < usage.CPUs || recommendation.SuggestedMemoryMB < usage.MemoryMB):
+		recommendation.Action = ActionDownsize
+		recommendation.SuggestedCPUs = minInt64(recommendation.SuggestedCPUs, usage.CPUs)
+		recommendation.SuggestedMemoryMB = minInt64(recommendation.SuggestedMemoryMB, usage.MemoryMB)
+	default:
+		recommendation.SuggestedCPUs = usage.CPUs
+		recommendation.SuggestedMemoryMB = usage.MemoryMB
+	}
+
+	return
+}
+
+// Summary of the evidence, e.g. CPU p95 0.40 of 4 vCPUs (10%), mean 0.21;
+// memory p95 2.1 of 15.0 GB (14%)
+func (r Recommendation) Summary() string {
+	return strings.Join(r.Reasons, "; ")
+}
+
+// vCPUs are a power of two
+func suggestedCPUs(p95, target float64) int64 {
+	needed := math.Max(p95/target, 1)
+	return int64(math.Pow(2, math.Ceil(math.Log2(needed))))
+}
+
+// Memory in steps of 256 MB, like custom machine types
+func suggestedMemoryMB(p95, target float64) int64 {
+	needed := math.Max(math.Ceil(p95/target/1024/1024/256), 1)
+	return int64(needed) * 256
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
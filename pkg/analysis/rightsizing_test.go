@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const gb = 1024 * 1024 * 1024
+
+// Stats of a series of values, false without any
+func statsOf(yValues ...float64) (Stats, bool) {
+	xValues, yValues := series(time.Hour, yValues...)
+	return Summarize(xValues, yValues, len(yValues))
+}
+
+func TestRecommend(t *testing.T) {
+	thresholds := Thresholds{UpsizeAbove: 0.8, DownsizeBelow: 0.3, Target: 0.6}
+	nan := math.NaN()
+
+	usage := func(cpus, memoryMB int64, cpu []float64, memory []float64) Usage {
+		u := Usage{CPUs: cpus, MemoryMB: memoryMB}
+		u.CPU, u.HasCPU = statsOf(cpu...)
+		u.Memory, u.HasMemory = statsOf(memory...)
+		return u
+	}
+
+	tests := []struct {
+		name       string
+		usage      Usage
+		thresholds Thresholds
+		action     string
+		cpus       int64
+		memoryMB   int64
+	}{
+		{"no machine type", usage(0, 0, []float64{1}, []float64{gb}), thresholds, ActionKeep, 0, 0},
+		{"empty CPU", usage(2, 7680, nil, []float64{gb}), thresholds, ActionKeep, 2, 7680},
+		{"only CPU gaps", usage(2, 7680, []float64{nan, nan}, []float64{gb}), thresholds, ActionKeep, 2, 7680},
+		{"busy CPU", usage(2, 7680, []float64{1, 1.9}, []float64{3 * gb}), thresholds, ActionUpsize, 4, 7680},
+		{"busy memory", usage(2, 7680, []float64{1}, []float64{7 * gb}), thresholds, ActionUpsize, 2, 12032},
+		{"idle", usage(4, 15360, []float64{0.2, 0.4}, []float64{2 * gb}), thresholds, ActionDownsize, 1, 3584},
+		{"one point", usage(4, 15360, []float64{0.4}, []float64{2 * gb}), thresholds, ActionDownsize, 1, 3584},
+		{"constant with NaN gaps", usage(4, 15360, []float64{0.4, nan, 0.4, 0.4}, []float64{2 * gb, nan}), thresholds, ActionDownsize, 1, 3584},
+		{"no memory data", usage(4, 15360, []float64{0.4}, nil), thresholds, ActionKeep, 4, 15360},
+		{"in between", usage(2, 7680, []float64{1}, []float64{4 * gb}), thresholds, ActionKeep, 2, 7680},
+		{"g1-small", usage(1, 1740, []float64{0.1}, []float64{0.4 * gb}), thresholds, ActionDownsize, 1, 768},
+		// The suggestion rounds above the current size, nothing shrinks
+		{"f1-micro", usage(1, 614, []float64{0.1}, []float64{0.17 * gb}), Thresholds{UpsizeAbove: 0.8, DownsizeBelow: 0.3, Target: 0.29}, ActionKeep, 1, 614},
+	}
+
+	for _, test := range tests {
+		r := Recommend(test.usage, test.thresholds)
+		if r.Action != test.action || r.SuggestedCPUs != test.cpus || r.SuggestedMemoryMB != test.memoryMB {
+			t.Errorf("%s: expect %s to %d vCPUs and %d MB, got %s to %d vCPUs and %d MB (%s)",
+				test.name, test.action, test.cpus, test.memoryMB, r.Action, r.SuggestedCPUs, r.SuggestedMemoryMB, r.Summary())
+		}
+		if r.Action == ActionDownsize && (r.SuggestedCPUs > test.usage.CPUs || r.SuggestedMemoryMB > test.usage.MemoryMB) {
+			t.Errorf("%s: expect a downsize to shrink, got %+v", test.name, r)
+		}
+	}
+}
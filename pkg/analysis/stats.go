@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats summarize the values of a time series. Coverage is the percentage of
+// the aligned points which have a value, PeakTime is when Max is first hit.
+type Stats struct {
+	Count    int
+	Min      float64
+	Max      float64
+	Mean     float64
+	P50      float64
+	P95      float64
+	P99      float64
+	Coverage float64
+	PeakTime time.Time
+}
+
+// Summarize the points of a series out of total aligned points, NaN values
+// are left out like the points without a value
+func Summarize(xValues []time.Time, yValues []float64, total int) (stats Stats, ok bool) {
+	if len(xValues) != len(yValues) {
+		return
+	}
+	xValues, yValues = withValues(xValues, yValues)
+	if len(yValues) == 0 {
+		return
+	}
+
+	stats.Count = len(yValues)
+	stats.Min = math.Inf(1)
+	stats.Max = math.Inf(-1)
+
+	var sum float64
+	for i, y := range yValues {
+		sum += y
+		if y < stats.Min {
+			stats.Min = y
+		}
+		if y > stats.Max {
+			stats.Max = y
+			stats.PeakTime = xValues[i]
+		}
+	}
+	stats.Mean = sum / float64(stats.Count)
+
+	sorted := append([]float64(nil), yValues...)
+	sort.Float64s(sorted)
+	stats.P50 = Percentile(sorted, 50)
+	stats.P95 = Percentile(sorted, 95)
+	stats.P99 = Percentile(sorted, 99)
+
+	if total > 0 {
+		stats.Coverage = float64(stats.Count) / float64(total) * 100
+	}
+	ok = true
+
+	return
+}
+
+// Percentile of sorted values, interpolated between the closest ranks
+func Percentile(sorted []float64, percent float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := percent / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// Points of a series which have a value, a NaN is a gap like a missing point
+func withValues(xValues []time.Time, yValues []float64) (xs []time.Time, ys []float64) {
+	for i, y := range yValues {
+		if !math.IsNaN(y) {
+			xs = append(xs, xValues[i])
+			ys = append(ys, y)
+		}
+	}
+
+	return
+}
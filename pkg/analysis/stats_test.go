@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var origin = time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// Points every step from origin
+func series(step time.Duration, yValues ...float64) ([]time.Time, []float64) {
+	xValues := make([]time.Time, len(yValues))
+	for i := range yValues {
+		xValues[i] = origin.Add(time.Duration(i) * step)
+	}
+
+	return xValues, yValues
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name    string
+		sorted  []float64
+		percent float64
+		expect  float64
+	}{
+		{"empty", nil, 95, 0},
+		{"one point", []float64{5}, 95, 5},
+		{"constant", []float64{3, 3, 3, 3}, 99, 3},
+		{"median of even", []float64{1, 2, 3, 4}, 50, 2.5},
+		{"interpolated", []float64{1, 2, 3, 4}, 95, 3.85},
+		{"lowest", []float64{1, 2, 3, 4}, 0, 1},
+		{"highest", []float64{1, 2, 3, 4}, 100, 4},
+	}
+
+	for _, test := range tests {
+		if got := Percentile(test.sorted, test.percent); !near(got, test.expect) {
+			t.Errorf("%s: expect %v, got %v", test.name, test.expect, got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name    string
+		yValues []float64
+		total   int
+		ok      bool
+		expect  Stats
+	}{
+		{"empty", nil, 0, false, Stats{}},
+		{"only gaps", []float64{nan, nan}, 2, false, Stats{}},
+		{"one point", []float64{7}, 4, true, Stats{Count: 1, Min: 7, Max: 7, Mean: 7, P50: 7, P95: 7, P99: 7, Coverage: 25, PeakTime: origin}},
+		{"constant", []float64{2, 2, 2, 2}, 4, true, Stats{Count: 4, Min: 2, Max: 2, Mean: 2, P50: 2, P95: 2, P99: 2, Coverage: 100, PeakTime: origin}},
+		{"NaN gaps", []float64{1, nan, 3, nan}, 4, true, Stats{Count: 2, Min: 1, Max: 3, Mean: 2, P50: 2, P95: 2.9, P99: 2.98, Coverage: 50, PeakTime: origin.Add(2 * time.Minute)}},
+		{"first peak", []float64{1, 4, 2, 4}, 0, true, Stats{Count: 4, Min: 1, Max: 4, Mean: 2.75, P50: 3, P95: 4, P99: 4, PeakTime: origin.Add(time.Minute)}},
+	}
+
+	for _, test := range tests {
+		xValues, yValues := series(time.Minute, test.yValues...)
+		stats, ok := Summarize(xValues, yValues, test.total)
+		if ok != test.ok {
+			t.Errorf("%s: expect ok %v, got %v", test.name, test.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		e := test.expect
+		if stats.Count != e.Count || !near(stats.Min, e.Min) || !near(stats.Max, e.Max) || !near(stats.Mean, e.Mean) ||
+			!near(stats.P50, e.P50) || !near(stats.P95, e.P95) || !near(stats.P99, e.P99) ||
+			!near(stats.Coverage, e.Coverage) || !stats.PeakTime.Equal(e.PeakTime) {
+			t.Errorf("%s: expect %+v, got %+v", test.name, e, stats)
+		}
+	}
+
+	if _, ok := Summarize([]time.Time{origin}, []float64{1, 2}, 2); ok {
+		t.Errorf("expect no stats of mismatched values")
+	}
+}
@@ -0,0 +1,47 @@
+package analysis
+
+import "time"
+
+// Trend is a straight line fitted over a time series, Slope is per second
+// since Origin.
+type Trend struct {
+	Origin    time.Time
+	Slope     float64
+	Intercept float64
+}
+
+// At is the value of the trend line at t
+func (t Trend) At(at time.Time) float64 {
+	return t.Slope*at.Sub(t.Origin).Seconds() + t.Intercept
+}
+
+// LinearTrend fits the points by least squares
+func LinearTrend(xValues []time.Time, yValues []float64) (trend Trend, ok bool) {
+	if len(xValues) < 2 || len(xValues) != len(yValues) {
+		return
+	}
+
+	// Seconds since the first point keep the sums small
+	trend.Origin = xValues[0]
+	n := float64(len(xValues))
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xValues {
+		x := xValues[i].Sub(trend.Origin).Seconds()
+		sumX += x
+		sumY += yValues[i]
+		sumXY += x * yValues[i]
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return
+	}
+
+	trend.Slope = (n*sumXY - sumX*sumY) / denominator
+	trend.Intercept = (sumY - trend.Slope*sumX) / n
+	ok = true
+
+	return
+}
@@ -0,0 +1,151 @@
+package gcp
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+
+	"google.golang.org/api/compute/v1"
+
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+)
+
+const (
+	InstanceStatusRunning = "RUNNING"
+	// Only known to Monitoring, the instance was deleted in the period
+	InstanceStatusDeleted = "DELETED"
+	// Only known to Monitoring, the Compute Engine API could not be listed
+	InstanceStatusUnknown = "UNKNOWN"
+)
+
+// Instance is one GCE instance of the inventory, stopped ones included.
+// CPUs and MemoryMB are the size of its machine type, zero when unknown.
+type Instance struct {
+	Name              string
+	ID                string
+	Zone              string
+	MachineType       string
+	Status            string
+	CreationTimestamp string
+	Labels            map[string]string
+	CPUs              int64
+	MemoryMB          int64
+}
+
+// Key names the files of the instance
+func (i Instance) Key() string {
+	return stackdriver.InstanceKey(i.Zone, i.ID)
+}
+
+// Region of the zone, e.g. asia-east1-a -> asia-east1
+func (i Instance) Region() string {
+	if idx := strings.LastIndex(i.Zone, "-"); idx > 0 {
+		return i.Zone[:idx]
+	}
+
+	return i.Zone
+}
+
+// ComputeClient lists instances through the Compute Engine API. Endpoint
+// overrides the API base path, e.g. a local server in tests.
+type ComputeClient struct {
+	Endpoint string
+	client   *http.Client
+}
+
+// Without client the default credentials are used, a local endpoint can do
+// with a plain http.Client
+func NewComputeClient(ctx context.Context, endpoint string, client *http.Client) (*ComputeClient, error) {
+	if client == nil {
+		var err error
+		client, err = google.DefaultClient(ctx, compute.ComputeReadonlyScope)
+		if err != nil {
+			return nil, fmt.Errorf("NewComputeClient: %v", err)
+		}
+	}
+
+	return &ComputeClient{Endpoint: endpoint, client: client}, nil
+}
+
+// Instances of every zone, sorted by zone and name. An error, e.g. the API
+// is not enabled in the project, leaves the instances to Monitoring.
+func (c *ComputeClient) GetInstances(ctx context.Context, projectID string) (instances []Instance, err error) {
+	svc, err := compute.New(c.client)
+	if err != nil {
+		return nil, fmt.Errorf("GetInstances: %v", err)
+	}
+	if c.Endpoint != "" {
+		svc.BasePath = c.Endpoint
+	}
+
+	aggregatedListCall := svc.Instances.AggregatedList(projectID)
+	err = aggregatedListCall.Pages(ctx, func(listResp *compute.InstanceAggregatedList) error {
+		for _, scopedList := range listResp.Items {
+			for _, instance := range scopedList.Instances {
+				instances = append(instances, Instance{
+					Name:              instance.Name,
+					ID:                fmt.Sprint(instance.Id),
+					Zone:              path.Base(instance.Zone),
+					MachineType:       path.Base(instance.MachineType),
+					Status:            instance.Status,
+					CreationTimestamp: instance.CreationTimestamp,
+					Labels:            instance.Labels,
+				})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetInstances: %v", err)
+	}
+
+	setMachineTypes(ctx, svc, projectID, instances)
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Zone != instances[j].Zone {
+			return instances[i].Zone < instances[j].Zone
+		}
+		return instances[i].Name < instances[j].Name
+	})
+
+	log.Printf("GetInstances: %d instance(s) in %s", len(instances), projectID)
+
+	return instances, nil
+}
+
+// Size the instances by their machine type, custom ones included. Each machine
+// type of a zone is read once.
+func setMachineTypes(ctx context.Context, svc *compute.Service, projectID string, instances []Instance) {
+	machineTypes := make(map[string]*compute.MachineType)
+
+	for i := range instances {
+		instance := &instances[i]
+		if instance.MachineType == "" {
+			continue
+		}
+
+		key := instance.Zone + "/" + instance.MachineType
+		machineType, ok := machineTypes[key]
+		if !ok {
+			var err error
+			machineType, err = svc.MachineTypes.Get(projectID, instance.Zone, instance.MachineType).Context(ctx).Do()
+			if err != nil {
+				log.Printf("setMachineTypes: %s of %s: %v", instance.MachineType, instance.Name, err)
+			}
+			machineTypes[key] = machineType
+		}
+		if machineType == nil {
+			continue
+		}
+
+		instance.CPUs = machineType.GuestCpus
+		instance.MemoryMB = machineType.MemoryMb
+	}
+}
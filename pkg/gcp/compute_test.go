@@ -0,0 +1,110 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const aggregatedInstances = `{
+  "items": {
+    "zones/us-central1-b": {
+      "instances": [
+        {
+          "name": "web-2",
+          "id": "2",
+          "zone": "https://www.googleapis.com/compute/v1/projects/demo/zones/us-central1-b",
+          "machineType": "https://www.googleapis.com/compute/v1/projects/demo/zones/us-central1-b/machineTypes/n1-standard-2",
+          "status": "TERMINATED",
+          "labels": {"env": "dev"}
+        }
+      ]
+    },
+    "zones/asia-northeast1-a": {
+      "instances": [
+        {
+          "name": "web-1",
+          "id": "1",
+          "zone": "https://www.googleapis.com/compute/v1/projects/demo/zones/asia-northeast1-a",
+          "machineType": "https://www.googleapis.com/compute/v1/projects/demo/zones/asia-northeast1-a/machineTypes/n1-standard-2",
+          "status": "RUNNING"
+        }
+      ]
+    },
+    "zones/europe-west1-b": {
+      "warning": {"code": "NO_RESULTS_ON_PAGE"}
+    }
+  }
+}`
+
+const machineType = `{"name": "n1-standard-2", "guestCpus": 2, "memoryMb": 7680}`
+
+// fakeCompute serves the instances of the project demo, every other project
+// answers like one without the Compute Engine API enabled
+func fakeCompute() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/compute/v1/projects/demo/aggregated/instances":
+			w.Write([]byte(aggregatedInstances))
+		case "/compute/v1/projects/demo/zones/asia-northeast1-a/machineTypes/n1-standard-2",
+			"/compute/v1/projects/demo/zones/us-central1-b/machineTypes/n1-standard-2":
+			w.Write([]byte(machineType))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"code": 403, "message": "Access Not Configured"}}`))
+		}
+	}))
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *ComputeClient {
+	client, err := NewComputeClient(context.Background(), server.URL+"/compute/v1/projects/", server.Client())
+	if err != nil {
+		t.Fatalf("NewComputeClient: %v", err)
+	}
+
+	return client
+}
+
+func TestGetInstances(t *testing.T) {
+	server := fakeCompute()
+	defer server.Close()
+
+	instances, err := newTestClient(t, server).GetInstances(context.Background(), "demo")
+	if err != nil {
+		t.Fatalf("GetInstances: %v", err)
+	}
+
+	expected := []Instance{
+		{Name: "web-1", ID: "1", Zone: "asia-northeast1-a", MachineType: "n1-standard-2", Status: InstanceStatusRunning, CPUs: 2, MemoryMB: 7680},
+		{Name: "web-2", ID: "2", Zone: "us-central1-b", MachineType: "n1-standard-2", Status: "TERMINATED", Labels: map[string]string{"env": "dev"}, CPUs: 2, MemoryMB: 7680},
+	}
+	if len(instances) != len(expected) {
+		t.Fatalf("expect %d instances, got %d: %+v", len(expected), len(instances), instances)
+	}
+	for i, e := range expected {
+		got := instances[i]
+		if got.Name != e.Name || got.ID != e.ID || got.Zone != e.Zone || got.MachineType != e.MachineType ||
+			got.Status != e.Status || got.CPUs != e.CPUs || got.MemoryMB != e.MemoryMB || got.Labels["env"] != e.Labels["env"] {
+			t.Errorf("instance %d: expect %+v, got %+v", i, e, got)
+		}
+	}
+	if instances[1].Region() != "us-central1" {
+		t.Errorf("expect region us-central1, got %s", instances[1].Region())
+	}
+}
+
+func TestGetInstancesError(t *testing.T) {
+	server := fakeCompute()
+	defer server.Close()
+
+	instances, err := newTestClient(t, server).GetInstances(context.Background(), "no-compute")
+	if err == nil {
+		t.Fatalf("expect an error, got %+v", instances)
+	}
+	if len(instances) != 0 {
+		t.Errorf("expect no instances, got %+v", instances)
+	}
+}
@@ -6,9 +6,15 @@ import (
 	"log"
 
 	"google.golang.org/api/cloudresourcemanager/v1beta1"
+
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
 )
 
-func GetProjects(ctx context.Context) []string {
+const ProjectLifecycleStateActive = "ACTIVE"
+
+// Active projects in the scope, every page of the project list is read.
+// Skipped projects are logged with the reason.
+func GetProjects(ctx context.Context, scope utils.ProjectScope) []string {
 	client, err := google.DefaultClient(ctx, cloudresourcemanager.CloudPlatformReadOnlyScope)
 	if err != nil {
 		log.Fatal("SetContext: ", err.Error())
@@ -19,17 +25,62 @@ func GetProjects(ctx context.Context) []string {
 		log.Fatal("GetProjects: ", err.Error())
 	}
 
+	var projectIDs []string
+	seen := make(map[string]bool)
+
 	projectsListCall := svc.Projects.List()
-	listResp, err := projectsListCall.Do()
+	err = projectsListCall.Pages(ctx, func(listResp *cloudresourcemanager.ListProjectsResponse) error {
+		for _, project := range listResp.Projects {
+			seen[project.ProjectId] = true
+
+			if project.LifecycleState != ProjectLifecycleStateActive {
+				log.Printf("GetProjects: skip %s, lifecycle state %s", project.ProjectId, project.LifecycleState)
+				continue
+			}
+
+			var ancestors []string
+			if scope.NeedsAncestry() {
+				ancestors = getAncestors(ctx, svc, project.ProjectId)
+			}
+
+			if ok, reason := scope.Match(project.ProjectId, project.Labels, ancestors); !ok {
+				log.Printf("GetProjects: skip %s, %s", project.ProjectId, reason)
+				continue
+			}
+
+			projectIDs = append(projectIDs, project.ProjectId)
+		}
+
+		return nil
+	})
 	if err != nil {
 		log.Fatal("GetProjects: ", err.Error())
 	}
 
-	projects := listResp.Projects
-	projectIDs := make([]string, len(projects))
-	for i := range projects {
-		projectIDs[i] = projects[i].ProjectId
+	for _, projectID := range scope.IDs {
+		if !seen[projectID] {
+			log.Printf("GetProjects: skip %s, the service account can't see it", projectID)
+		}
 	}
 
+	log.Printf("GetProjects: %d project(s) to report", len(projectIDs))
+
 	return projectIDs
 }
+
+// e.g. [folders/123 organizations/456], the project itself is left out
+func getAncestors(ctx context.Context, svc *cloudresourcemanager.Service, projectID string) (ancestors []string) {
+	resp, err := svc.Projects.GetAncestry(projectID, &cloudresourcemanager.GetAncestryRequest{}).Context(ctx).Do()
+	if err != nil {
+		log.Fatal("getAncestors: ", err.Error())
+	}
+
+	for _, ancestor := range resp.Ancestor {
+		if ancestor.ResourceId == nil || ancestor.ResourceId.Type == "project" {
+			continue
+		}
+		ancestors = append(ancestors, ancestor.ResourceId.Type+"s/"+ancestor.ResourceId.Id)
+	}
+
+	return
+}
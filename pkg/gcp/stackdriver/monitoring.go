@@ -1,9 +1,14 @@
 package stackdriver
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
 	"time"
 
 	"golang.org/x/net/context"
@@ -20,66 +25,218 @@ const (
 	AggregationPerSeriesAlignerRate = "ALIGN_RATE"
 	AggregationPerSeriesAlignerMean = "ALIGN_MEAN"
 
-	HoursOfOneWeek = 24 * 7
+	// Every GCE instance reports it, so it is used to find the instances
+	InstanceDiscoveryMetric = "compute.googleapis.com/instance/cpu/usage_time"
+
+	ResourceGCEInstance      = "gce_instance"
+	ResourceCloudSQLDatabase = "cloudsql_database"
+	ResourceK8sContainer     = "k8s_container"
+	ResourceK8sNode          = "k8s_node"
+
+	ListStatsCSVHeader = "metric,pages,time_series,source"
+
+	// Sources of list stats: the resource discovery of the stuff job, the
+	// export tasks and the comparison data fetched by the report job
+	ListSourceDiscovery  = "discovery"
+	ListSourceExport     = "export"
+	ListSourceComparison = "comparison"
 )
 
+// Discovery is the metric every resource of a kind reports and the labels
+// which identify the resource. GCE instances are identified by their ID and
+// zone, their name is only displayed.
+type Discovery struct {
+	Metric    string
+	Label     string
+	ZoneLabel string
+	NameLabel string
+}
+
+var Discoveries = map[string]Discovery{
+	ResourceGCEInstance: {
+		Metric:    InstanceDiscoveryMetric,
+		Label:     "resource.labels.instance_id",
+		ZoneLabel: "resource.labels.zone",
+		NameLabel: "metric.labels.instance_name",
+	},
+	ResourceCloudSQLDatabase: {
+		Metric: "cloudsql.googleapis.com/database/up",
+		Label:  "resource.labels.database_id",
+	},
+	// GKE metrics are collected per cluster
+	ResourceK8sContainer: {
+		Metric: "kubernetes.io/container/uptime",
+		Label:  "resource.labels.cluster_name",
+	},
+	ResourceK8sNode: {
+		Metric: "kubernetes.io/node/cpu/allocatable_cores",
+		Label:  "resource.labels.cluster_name",
+	},
+}
+
+// Display and file name of a resource, a Cloud SQL database_id is
+// <project_id>:<instance_name>.
+func ResourceDisplayName(resource, resourceID string) string {
+	if resource == ResourceCloudSQLDatabase {
+		if idx := strings.LastIndex(resourceID, ":"); idx >= 0 {
+			return resourceID[idx+1:]
+		}
+	}
+
+	return resourceID
+}
+
+// File name of a GCE instance, instance IDs are only unique within a zone,
+// e.g. asia-east1-a_1234567890123456789
+func InstanceKey(zone, instanceID string) string {
+	return zone + "_" + instanceID
+}
+
+// MonitoredResource is one resource found by its discovery metric
+type MonitoredResource struct {
+	Type   string
+	ID     string
+	Zone   string
+	Name   string
+	Labels map[string]string
+}
+
+// Key names the files of the resource
+func (r MonitoredResource) Key() string {
+	if r.Type == ResourceGCEInstance {
+		return InstanceKey(r.Zone, r.ID)
+	}
+
+	return ResourceDisplayName(r.Type, r.ID)
+}
+
+// ListStats records how much of a TimeSeries.List result was read, so the
+// report can state whether the data is complete.
+type ListStats struct {
+	Metric     string
+	Pages      int
+	TimeSeries int
+	Source     string
+}
+
+// AddListStats sums stats into the entry of the same metric and source
+func AddListStats(listStats []ListStats, stats ListStats) []ListStats {
+	for i := range listStats {
+		if listStats[i].Metric == stats.Metric && listStats[i].Source == stats.Source {
+			listStats[i].Pages += stats.Pages
+			listStats[i].TimeSeries += stats.TimeSeries
+			return listStats
+		}
+	}
+
+	return append(listStats, stats)
+}
+
+// TimeSeriesPoints is one time series returned for a filter, keyed by its
+// metric and resource labels.
+type TimeSeriesPoints struct {
+	Key          string
+	Name         string
+	Labels       map[string]string
+	MetricPoints []string
+	XValues      []time.Time
+	YValues      []float64
+	// Whether the aligned point has a value, YValues are zero otherwise
+	Valid []bool
+	// Extra aligners, one CSV column and one value per point each
+	Columns     []string
+	ExtraValues map[string][]float64
+}
+
+// Header of the CSV file of the series
+func (s TimeSeriesPoints) CSVHeader() string {
+	if len(s.Columns) == 0 {
+		return PointCSVHeader
+	}
+
+	return PointCSVHeader + "," + strings.Join(s.Columns, ",")
+}
+
+// Aggregation is how the points of a metric are aligned and reduced.
+type Aggregation struct {
+	Aligner         string
+	Reducer         string
+	GroupBy         []string
+	AlignmentPeriod string
+	// Retrieved next to Aligner, e.g. ALIGN_MAX
+	ExtraAligners []string
+}
+
+// CSV column of an aligner, e.g. ALIGN_PERCENTILE_95 -> p95
+func AlignerColumn(aligner string) string {
+	column := strings.ToLower(strings.TrimPrefix(aligner, "ALIGN_"))
+
+	return strings.Replace(column, "percentile_", "p", 1)
+}
+
+func (a Aggregation) alignmentPeriod() string {
+	if a.AlignmentPeriod == "" {
+		return AggregationAlignmentPeriod
+	}
+
+	return a.AlignmentPeriod
+}
+
+// Step is the duration between two aligned points
+func (a Aggregation) Step() time.Duration {
+	step, err := time.ParseDuration(a.alignmentPeriod())
+	if err != nil || step <= 0 {
+		log.Fatalf("Invalid alignment period %q: %v", a.AlignmentPeriod, err)
+	}
+
+	return step
+}
+
 /************************************************
 
 Initialize and Configuraion
 
 ************************************************/
 type MonitoringClient struct {
-	TimeZone          int
+	location          *time.Location
 	StartTime         time.Time
 	EndTime           time.Time
 	IntervalStartTime string
 	IntervalEndTime   string
-	TotalHours        int
+	PageSize          int64
 	client            *http.Client
 }
 
-func (c *MonitoringClient) SetTimezone(timezone int) {
-	c.TimeZone = timezone
+// Period boundaries, CSV datetimes and chart axes are in the location
+func (c *MonitoringClient) SetLocation(location *time.Location) {
+	c.location = location
 }
 
-// Previous week
-func (c *MonitoringClient) SetWeekly() {
-	local := c.Location()
-	now := time.Now().In(local)
-	weekStartDay := now.AddDate(0, 0, -(int)(now.Weekday()))
-
-	c.EndTime = time.Date(weekStartDay.Year(), weekStartDay.Month(), weekStartDay.Day(), 0, 0, 0, 0, local).UTC()
-	c.StartTime = c.EndTime.AddDate(0, 0, -7)
-
-	c.IntervalEndTime = c.EndTime.Format("2006-01-02T15:04:05.000000000Z")
-	c.IntervalStartTime = c.StartTime.Format("2006-01-02T15:04:05.000000000Z")
-
-	log.Printf("IntervalEndTime  : %s", c.IntervalEndTime)
-	log.Printf("IntervalStartTime: %s", c.IntervalStartTime)
-
-	c.TotalHours = HoursOfOneWeek
+// Zero means the API default page size
+func (c *MonitoringClient) SetPageSize(pageSize int64) {
+	c.PageSize = pageSize
 }
 
-// Previous month
-func (c *MonitoringClient) SetMonthly() {
-	local := c.Location()
-	now := time.Now().In(local)
-
-	c.EndTime = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, local).UTC()
-	c.StartTime = c.EndTime.AddDate(0, 0, -c.EndTime.Day())
+// SetInterval sets the interval of the queried points, e.g. a report period
+// or the one of an export task
+func (c *MonitoringClient) SetInterval(startTime, endTime time.Time) {
+	c.StartTime = startTime.UTC()
+	c.EndTime = endTime.UTC()
 
 	c.IntervalEndTime = c.EndTime.Format("2006-01-02T15:04:05.000000000Z")
 	c.IntervalStartTime = c.StartTime.Format("2006-01-02T15:04:05.000000000Z")
 
 	log.Printf("IntervalEndTime  : %s", c.IntervalEndTime)
 	log.Printf("IntervalStartTime: %s", c.IntervalStartTime)
-
-	c.TotalHours = c.EndTime.AddDate(0, 0, -1).Day() * 24
 }
 
+// UTC when no location is set
 func (c *MonitoringClient) Location() *time.Location {
-	localSecondsEastOfUTC := int((time.Duration(c.TimeZone) * time.Hour).Seconds())
-	return time.FixedZone("localtime", localSecondsEastOfUTC)
+	if c.location == nil {
+		return time.UTC
+	}
+
+	return c.location
 }
 
 func (c *MonitoringClient) getCred(ctx context.Context) (cred *google.Credentials) {
@@ -130,46 +287,97 @@ Generate Metric Filter
 
 ************************************************/
 
-func MakeInstanceFilter(metric, instanceName string) string {
-	return fmt.Sprintf(`metric.type="%s" AND metric.labels.instance_name="%s"`, metric, instanceName)
-}
+// The filter template gets {{.Metric}}, {{.InstanceName}}, {{.InstanceID}}
+// and {{.Zone}}, e.g.
+//
+// metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"
+//
+// InstanceName is the ID of resources other than GCE instances.
+func MakeFilter(filterTemplate, metric string, resource MonitoredResource) string {
+	tmpl, err := template.New("filter").Parse(filterTemplate)
+	if err != nil {
+		log.Fatalf("MakeFilter: %v", err)
+	}
 
-// Only query instance used memory from agent
-func MakeAgentMemoryFilter(metric, instanceName string) string {
-	return fmt.Sprintf(`metric.type="%s" AND metadata.user_labels.name="%s" AND metric.labels.state="%s"`, metric, instanceName, "used")
+	instanceName := resource.Name
+	if resource.Type != ResourceGCEInstance {
+		instanceName = resource.ID
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, struct {
+		Metric       string
+		InstanceName string
+		InstanceID   string
+		Zone         string
+	}{metric, instanceName, resource.ID, resource.Zone})
+	if err != nil {
+		log.Fatalf("MakeFilter: %v", err)
+	}
+
+	return b.String()
 }
 
 /************************************************
 
-Get GCE Instance Name in Project
+Get Resources in Project
 
 ************************************************/
 
-func (c *MonitoringClient) GetInstanceNames(projectID, metric string) (instanceNames []string) {
+// Resources of a kind which reported data in the interval
+func (c *MonitoringClient) GetResources(projectID, resource string) (resources []MonitoredResource, stats ListStats) {
+	discovery, ok := Discoveries[resource]
+	if !ok {
+		log.Fatalf("GetResources: unknown resource %s", resource)
+	}
+
 	client := c.getClient()
 
 	svc, err := monitoring.New(client)
 	if err != nil {
-		log.Fatal("GetInstanceNames: ", err.Error())
+		log.Fatal("GetResources: ", err.Error())
 	}
 
 	project := "projects/" + projectID
 
 	projectsTimeSeriesListCall := svc.Projects.TimeSeries.List(project)
 	projectsTimeSeriesListCall.View("HEADERS")
-	projectsTimeSeriesListCall.Filter(`metric.type="` + metric + `"`)
+	projectsTimeSeriesListCall.Filter(`metric.type="` + discovery.Metric + `"`)
 	projectsTimeSeriesListCall.IntervalStartTime(c.IntervalStartTime)
 	projectsTimeSeriesListCall.IntervalEndTime(c.IntervalEndTime)
 
-	listResp, err := projectsTimeSeriesListCall.Do()
-	if err != nil {
-		log.Fatal("GetInstanceNames: ", err.Error())
-	}
+	// The user labels of every series of a resource, e.g. the labels of a
+	// deleted GCE instance
+	seen := make(map[string]int)
+	stats = c.listTimeSeries(projectsTimeSeriesListCall, func(timeSeries *monitoring.TimeSeries) {
+		labels := timeSeriesLabels(timeSeries)
+
+		r := MonitoredResource{
+			Type:   resource,
+			ID:     labels[discovery.Label],
+			Zone:   labels[discovery.ZoneLabel],
+			Name:   labels[discovery.NameLabel],
+			Labels: make(map[string]string),
+		}
+		if r.ID == "" {
+			return
+		}
+		if idx, ok := seen[r.Key()]; ok {
+			r = resources[idx]
+		} else {
+			seen[r.Key()] = len(resources)
+			resources = append(resources, r)
+		}
+		for k, v := range labels {
+			if strings.HasPrefix(k, userLabelPrefix) {
+				r.Labels[strings.TrimPrefix(k, userLabelPrefix)] = v
+			}
+		}
+	})
+	stats.Metric = discovery.Metric
+	stats.Source = ListSourceDiscovery
 
-	instanceNames = make([]string, len(listResp.TimeSeries))
-	for i := range listResp.TimeSeries {
-		instanceNames[i] = listResp.TimeSeries[i].Metric.Labels["instance_name"]
-	}
+	log.Printf("GetResources: %d time series in %d page(s)", stats.TimeSeries, stats.Pages)
 
 	return
 }
@@ -180,7 +388,30 @@ Timeseries List
 
 ************************************************/
 
-func (c *MonitoringClient) RetrieveMetricPoints(projectID, metric, aligner, filter string) (metricPoints []string, xValues []time.Time, yValues []float64) {
+// Walk every page of the list call, the API truncates a single response
+func (c *MonitoringClient) listTimeSeries(projectsTimeSeriesListCall *monitoring.ProjectsTimeSeriesListCall, fn func(*monitoring.TimeSeries)) (stats ListStats) {
+	if c.PageSize > 0 {
+		projectsTimeSeriesListCall.PageSize(c.PageSize)
+	}
+
+	err := projectsTimeSeriesListCall.Pages(context.Background(), func(listResp *monitoring.ListTimeSeriesResponse) error {
+		stats.Pages++
+		stats.TimeSeries += len(listResp.TimeSeries)
+
+		for i := range listResp.TimeSeries {
+			fn(listResp.TimeSeries[i])
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Fatal("listTimeSeries: ", err.Error())
+	}
+
+	return
+}
+
+func (c *MonitoringClient) RetrieveMetricPoints(projectID, metric string, aggregation Aggregation, filter string) (series []TimeSeriesPoints, stats ListStats) {
 	client := c.getClient()
 
 	svc, err := monitoring.New(client)
@@ -188,6 +419,63 @@ func (c *MonitoringClient) RetrieveMetricPoints(projectID, metric, aligner, filt
 		log.Fatal("RetrieveMetricPoints: ", err.Error())
 	}
 
+	keys, labelsMap, pointsMap, stats := c.listSeriesPoints(svc, projectID, aggregation.Aligner, aggregation, filter)
+	stats.Metric = metric
+	stats.Source = ListSourceExport
+
+	// One more call per extra aligner, joined to the series by key. Its pages
+	// are read as well, its series are the same.
+	extraPointsMaps := make([]map[string][]*monitoring.Point, len(aggregation.ExtraAligners))
+	for i, aligner := range aggregation.ExtraAligners {
+		var extraStats ListStats
+		_, _, extraPointsMaps[i], extraStats = c.listSeriesPoints(svc, projectID, aligner, aggregation, filter)
+		stats.Pages += extraStats.Pages
+	}
+
+	log.Printf("RetrieveMetricPoints: %d time series in %d page(s)", stats.TimeSeries, stats.Pages)
+
+	sort.Strings(keys)
+	names := seriesNames(keys, labelsMap)
+	step := aggregation.Step()
+
+	var columns []string
+	for _, aligner := range aggregation.ExtraAligners {
+		columns = append(columns, AlignerColumn(aligner))
+	}
+
+	for _, key := range keys {
+		points := pointsMap[key]
+		if len(points) == 0 {
+			continue
+		}
+
+		extraPoints := make([][]*monitoring.Point, len(extraPointsMaps))
+		extraValues := make(map[string][]float64)
+		for i := range extraPointsMaps {
+			extraPoints[i] = extraPointsMaps[i][key]
+			_, extraValues[columns[i]], _ = c.pointsToXY(extraPoints[i], step)
+		}
+
+		xValues, yValues, valid := c.pointsToXY(points, step)
+		series = append(series, TimeSeriesPoints{
+			Key:          key,
+			Name:         names[key],
+			Labels:       labelsMap[key],
+			MetricPoints: c.pointsToMetricPoints(points, step, extraPoints...),
+			XValues:      xValues,
+			YValues:      yValues,
+			Valid:        valid,
+			Columns:      columns,
+			ExtraValues:  extraValues,
+		})
+	}
+
+	return
+}
+
+// The points of every series aligned with aligner, the points of one series
+// may be split across pages.
+func (c *MonitoringClient) listSeriesPoints(svc *monitoring.Service, projectID, aligner string, aggregation Aggregation, filter string) (keys []string, labelsMap map[string]map[string]string, pointsMap map[string][]*monitoring.Point, stats ListStats) {
 	project := "projects/" + projectID
 
 	projectsTimeSeriesListCall := svc.Projects.TimeSeries.List(project)
@@ -195,97 +483,227 @@ func (c *MonitoringClient) RetrieveMetricPoints(projectID, metric, aligner, filt
 	projectsTimeSeriesListCall.IntervalStartTime(c.IntervalStartTime)
 	projectsTimeSeriesListCall.IntervalEndTime(c.IntervalEndTime)
 	projectsTimeSeriesListCall.AggregationPerSeriesAligner(aligner)
-	projectsTimeSeriesListCall.AggregationAlignmentPeriod(AggregationAlignmentPeriod)
-
-	listResp, err := projectsTimeSeriesListCall.Do()
-	if err != nil {
-		log.Fatal("RetrieveMetricPoints projectsTimeSeriesListCall: ", err.Error())
+	projectsTimeSeriesListCall.AggregationAlignmentPeriod(aggregation.alignmentPeriod())
+	if aggregation.Reducer != "" {
+		projectsTimeSeriesListCall.AggregationCrossSeriesReducer(aggregation.Reducer)
+		projectsTimeSeriesListCall.AggregationGroupByFields(aggregation.GroupBy...)
 	}
 
-	// Only get the first timeseries
-	if len(listResp.TimeSeries) > 0 {
-		timeSeries := listResp.TimeSeries[0]
+	labelsMap = make(map[string]map[string]string)
+	pointsMap = make(map[string][]*monitoring.Point)
+	stats = c.listTimeSeries(projectsTimeSeriesListCall, func(timeSeries *monitoring.TimeSeries) {
+		labels := timeSeriesLabels(timeSeries)
+		key := seriesKey(labels)
 
-		if len(timeSeries.Points) > 0 {
-			metricPoints = c.pointsToMetricPoints(timeSeries.Points)
-			xValues, yValues = c.pointsToXY(timeSeries.Points)
-			return
+		if _, ok := labelsMap[key]; !ok {
+			keys = append(keys, key)
+			labelsMap[key] = labels
 		}
-	}
+		pointsMap[key] = append(pointsMap[key], timeSeries.Points...)
+	})
 
 	return
 }
 
 /************************************************
 
-Timeseries CSV point (timestamp,datetime,value)
+Timeseries Labels
 
 ************************************************/
 
-func (c *MonitoringClient) pointsToMetricPoints(points []*monitoring.Point) (metricPoints []string) {
-	metricPoints = make([]string, c.TotalHours)
+const userLabelPrefix = "metadata.user_labels."
 
-	pointTime := c.StartTime
-	var pointIdx = len(points) - 1
-	var t time.Time
-	for metricIdx := range metricPoints {
-		pointTime = pointTime.Add(time.Hour)
+func timeSeriesLabels(timeSeries *monitoring.TimeSeries) map[string]string {
+	labels := make(map[string]string)
+
+	if timeSeries.Metric != nil {
+		for k, v := range timeSeries.Metric.Labels {
+			labels["metric.labels."+k] = v
+		}
+	}
+	if timeSeries.Resource != nil {
+		for k, v := range timeSeries.Resource.Labels {
+			labels["resource.labels."+k] = v
+		}
+	}
+	if timeSeries.Metadata != nil {
+		for k, v := range timeSeries.Metadata.UserLabels {
+			labels[userLabelPrefix+k] = v
+		}
+
+		// Only string system labels, e.g. top_level_controller_name
+		var systemLabels map[string]interface{}
+		if err := json.Unmarshal(timeSeries.Metadata.SystemLabels, &systemLabels); err == nil {
+			for k, v := range systemLabels {
+				if value, ok := v.(string); ok {
+					labels["metadata.system_labels."+k] = value
+				}
+			}
+		}
+	}
 
-		if pointIdx >= 0 {
-			t, _ = time.Parse("2006-01-02T15:04:05Z", points[pointIdx].Interval.StartTime)
+	return labels
+}
 
-			if pointTime.Equal(t) {
-				t = t.Add(time.Hour * (time.Duration)(c.TimeZone))
-				metricPoints[metricIdx] = fmt.Sprintf("%d,%s,%f", t.Unix(), t.Format("2006-01-02 15:04:05"), *(points[pointIdx].Value.DoubleValue))
+// e.g. metric.labels.instance_name=web-1,resource.labels.zone=asia-east1-a
+func seriesKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
 
-				pointIdx = pointIdx - 1
+	return strings.Join(pairs, ",")
+}
+
+// Name each series by the label values that tell it apart from the others,
+// a single series has an empty name.
+func seriesNames(keys []string, labelsMap map[string]map[string]string) map[string]string {
+	names := make(map[string]string)
+	if len(keys) < 2 {
+		return names
+	}
 
+	var distinct []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		for k := range labelsMap[key] {
+			if seen[k] {
 				continue
 			}
+			seen[k] = true
+
+			for _, other := range keys {
+				if labelsMap[other][k] != labelsMap[key][k] {
+					distinct = append(distinct, k)
+					break
+				}
+			}
 		}
+	}
+	sort.Strings(distinct)
 
-		t = pointTime.Add(time.Hour * (time.Duration)(c.TimeZone))
-		metricPoints[metricIdx] = fmt.Sprintf("%d,%s,", t.Unix(), t.Format("2006-01-02 15:04:05"))
+	r := regexp.MustCompile(`[^\w-]+`)
+	for _, key := range keys {
+		values := make([]string, len(distinct))
+		for i, k := range distinct {
+			values[i] = r.ReplaceAllString(labelsMap[key][k], "-")
+		}
+		names[key] = strings.Join(values, "_")
 	}
 
-	return
+	return names
 }
 
 /************************************************
 
-Timeseries Graph point (X, Y)
+Timeseries CSV point (timestamp,datetime,value[,extra aligners])
 
 ************************************************/
 
-func (c *MonitoringClient) pointsToXY(points []*monitoring.Point) (xValues []time.Time, yValues []float64) {
-	xValues = make([]time.Time, c.TotalHours)
-	yValues = make([]float64, c.TotalHours)
+// Number of aligned points between StartTime and EndTime
+func (c *MonitoringClient) totalSteps(step time.Duration) int {
+	return int(c.EndTime.Sub(c.StartTime) / step)
+}
+
+// Put every point in the slot of its aligned time, the slots are
+// StartTime + step, StartTime + 2 * step, ... EndTime. Slots without a point
+// are not valid.
+func (c *MonitoringClient) alignedValues(points []*monitoring.Point, step time.Duration) (pointTimes []time.Time, values []float64, valid []bool) {
+	totalSteps := c.totalSteps(step)
+	pointTimes = make([]time.Time, totalSteps)
+	values = make([]float64, totalSteps)
+	valid = make([]bool, totalSteps)
+
+	for i := range pointTimes {
+		pointTimes[i] = c.StartTime.Add(step * time.Duration(i+1))
+	}
+
+	for _, point := range points {
+		t, err := time.Parse(time.RFC3339Nano, point.Interval.StartTime)
+		if err != nil {
+			continue
+		}
 
-	pointTime := c.StartTime
-	var pointIdx = len(points) - 1
-	var t time.Time
-	for metricIdx := 0; metricIdx < c.TotalHours; metricIdx++ {
-		pointTime = pointTime.Add(time.Hour)
+		// Round to the nearest slot
+		idx := int((t.Sub(c.StartTime)+step/2)/step) - 1
+		if idx < 0 || idx >= totalSteps {
+			continue
+		}
 
-		if pointIdx >= 0 {
-			t, _ = time.Parse("2006-01-02T15:04:05Z", points[pointIdx].Interval.StartTime)
+		value, ok := pointValue(point)
+		if !ok {
+			continue
+		}
 
-			if pointTime.Equal(t) {
-				t = t.Add(time.Hour * (time.Duration)(c.TimeZone))
+		values[idx] = value
+		valid[idx] = true
+	}
 
-				xValues[metricIdx] = t
-				yValues[metricIdx] = *(points[pointIdx].Value.DoubleValue)
+	return
+}
 
-				pointIdx = pointIdx - 1
+func pointValue(point *monitoring.Point) (float64, bool) {
+	if point.Value == nil {
+		return 0, false
+	}
+	if point.Value.DoubleValue != nil {
+		return *point.Value.DoubleValue, true
+	}
+	if point.Value.Int64Value != nil {
+		return float64(*point.Value.Int64Value), true
+	}
 
-				continue
+	return 0, false
+}
+
+// The timestamp is Unix time and the datetime is local time. Values of the
+// extra aligners follow the value, empty when missing
+func (c *MonitoringClient) pointsToMetricPoints(points []*monitoring.Point, step time.Duration, extraPoints ...[]*monitoring.Point) (metricPoints []string) {
+	pointTimes, values, valid := c.alignedValues(points, step)
+	metricPoints = make([]string, len(pointTimes))
+
+	extraValues := make([][]float64, len(extraPoints))
+	extraValid := make([][]bool, len(extraPoints))
+	for i := range extraPoints {
+		_, extraValues[i], extraValid[i] = c.alignedValues(extraPoints[i], step)
+	}
+
+	for metricIdx := range metricPoints {
+		t := pointTimes[metricIdx].In(c.Location())
+
+		line := fmt.Sprintf("%d,%s,", t.Unix(), t.Format("2006-01-02 15:04:05"))
+		if valid[metricIdx] {
+			line += fmt.Sprintf("%f", values[metricIdx])
+		}
+
+		for i := range extraValues {
+			line += ","
+			if extraValid[i][metricIdx] {
+				line += fmt.Sprintf("%f", extraValues[i][metricIdx])
 			}
 		}
 
-		t = pointTime.Add(time.Hour * (time.Duration)(c.TimeZone))
+		metricPoints[metricIdx] = line
+	}
+
+	return
+}
+
+/************************************************
+
+Timeseries Graph point (X, Y)
+
+************************************************/
+
+// Slots without a point are 0
+func (c *MonitoringClient) pointsToXY(points []*monitoring.Point, step time.Duration) (xValues []time.Time, yValues []float64, valid []bool) {
+	pointTimes, values, valid := c.alignedValues(points, step)
+	xValues = make([]time.Time, len(pointTimes))
+	yValues = values
 
-		xValues[metricIdx] = t
-		yValues[metricIdx] = 0
+	for metricIdx := range xValues {
+		xValues[metricIdx] = pointTimes[metricIdx].In(c.Location())
 	}
 
 	return
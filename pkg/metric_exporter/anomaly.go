@@ -0,0 +1,146 @@
+package metric_exporter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Anomalies
+
+************************************************/
+
+// Red dots on the anomalies of every series, the points without a value are
+// left out like in the CSV
+func (g *GCSExporter) anomalySeries(series []stackdriver.TimeSeriesPoints) []chart.Series {
+	if g.Anomalies.Disabled {
+		return nil
+	}
+
+	var xValues []time.Time
+	var yValues []float64
+	for _, s := range series {
+		var xs []time.Time
+		var ys []float64
+		for i := range s.XValues {
+			if i < len(s.Valid) && s.Valid[i] {
+				xs = append(xs, s.XValues[i])
+				ys = append(ys, s.YValues[i])
+			}
+		}
+
+		for _, anomaly := range analysis.DetectAnomalies(xs, ys, g.Anomalies.Options()) {
+			xValues = append(xValues, anomaly.Time)
+			yValues = append(yValues, anomaly.Value)
+		}
+	}
+	if len(xValues) == 0 {
+		return nil
+	}
+
+	return []chart.Series{chart.TimeSeries{
+		Name:    "anomalies",
+		XValues: xValues,
+		YValues: yValues,
+		Style: chart.Style{
+			Show:        true,
+			StrokeWidth: chart.Disabled,
+			DotWidth:    4,
+			DotColor:    drawing.ColorRed,
+		},
+	}}
+}
+
+// seriesAnomaly is an anomaly of one series of a chart, Series is empty when
+// the chart has a single series
+type seriesAnomaly struct {
+	Series  string
+	Anomaly analysis.Anomaly
+}
+
+// Anomalies of each instance keyed by metric name, detected on the series read
+// back from the CSVs the same way as on the charts
+func (g *GCSExporter) detectAnomalies(seriesMaps map[string]map[string][]SeriesValues) map[string]map[string][]seriesAnomaly {
+	anomalies := make(map[string]map[string][]seriesAnomaly)
+	if g.Anomalies.Disabled {
+		return anomalies
+	}
+
+	for instanceName, seriesMap := range seriesMaps {
+		anomalies[instanceName] = make(map[string][]seriesAnomaly)
+
+		for metricName, seriesList := range seriesMap {
+			for _, series := range seriesList {
+				for _, anomaly := range analysis.DetectAnomalies(series.XValues, series.YValues, g.Anomalies.Options()) {
+					anomalies[instanceName][metricName] = append(anomalies[instanceName][metricName], seriesAnomaly{
+						Series:  series.Name,
+						Anomaly: anomaly,
+					})
+				}
+			}
+		}
+	}
+
+	return anomalies
+}
+
+// reportAnomaly is an anomaly with the chart it is on
+type reportAnomaly struct {
+	Name   string
+	Metric utils.MetricConf
+	seriesAnomaly
+}
+
+// Every anomaly of the report in the order of its pages
+func reportAnomalies(chapters []reportChapter) (anomalies []reportAnomaly) {
+	for _, chapter := range chapters {
+		for _, section := range chapter.Sections {
+			for _, key := range section.Keys {
+				for _, metric := range chapter.Metrics {
+					for _, anomaly := range section.Anomalies[key][metric.Name] {
+						anomalies = append(anomalies, reportAnomaly{
+							Name:          displayName(key, section.Names),
+							Metric:        metric,
+							seriesAnomaly: anomaly,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// e.g. 10/31 14:00  web-1 (asia-east1-a)  CPU Usage Time  spike + 0.980 cores (z 6.2)
+func writeAnomalies(pdf *gofpdf.Fpdf, anomalies []reportAnomaly) {
+	if len(anomalies) == 0 {
+		return
+	}
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(0, 10, "Anomalies", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Times", "", 10)
+	for _, a := range anomalies {
+		title := a.Metric.Title
+		if a.Series != "" {
+			title = fmt.Sprintf("%s [%s]", title, a.Series)
+		}
+
+		pdf.CellFormat(25, 6, a.Anomaly.Time.Format("01/02 15:04"), "", 0, "L", false, 0, "")
+		pdf.CellFormat(55, 6, a.Name, "", 0, "L", false, 0, "")
+		pdf.CellFormat(50, 6, title, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, fmt.Sprintf("%s %s (z %.1f)", a.Anomaly.Kind, utils.GetValueFormatter(a.Metric.Unit)(a.Anomaly.Value), a.Anomaly.Score), "", 1, "L", false, 0, "")
+	}
+}
@@ -0,0 +1,57 @@
+package metric_exporter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/util"
+)
+
+// bandSeries shades the area between Y1s and Y2s, e.g. the max and min
+// values of a series.
+type bandSeries struct {
+	Name    string
+	Style   chart.Style
+	YAxis   chart.YAxisType
+	XValues []time.Time
+	Y1s     []float64
+	Y2s     []float64
+}
+
+func (bs bandSeries) GetName() string {
+	return bs.Name
+}
+
+func (bs bandSeries) GetStyle() chart.Style {
+	return bs.Style
+}
+
+func (bs bandSeries) GetYAxis() chart.YAxisType {
+	return bs.YAxis
+}
+
+func (bs bandSeries) Len() int {
+	return len(bs.XValues)
+}
+
+// GetBoundedValues makes the band a chart.BoundedValuesProvider, so the
+// ranges of the chart include it
+func (bs bandSeries) GetBoundedValues(index int) (x, y1, y2 float64) {
+	x = util.Time.ToFloat64(bs.XValues[index])
+	y1 = bs.Y1s[index]
+	y2 = bs.Y2s[index]
+	return
+}
+
+func (bs bandSeries) Render(r chart.Renderer, canvasBox chart.Box, xrange, yrange chart.Range, defaults chart.Style) {
+	style := bs.Style.InheritFrom(defaults)
+	chart.Draw.BoundedSeries(r, canvasBox, xrange, yrange, style, bs)
+}
+
+func (bs bandSeries) Validate() error {
+	if len(bs.Y1s) != len(bs.XValues) || len(bs.Y2s) != len(bs.XValues) {
+		return fmt.Errorf("band series %q needs as many values as times", bs.Name)
+	}
+	return nil
+}
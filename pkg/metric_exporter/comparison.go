@@ -0,0 +1,217 @@
+package metric_exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/jung-kurt/gofpdf"
+	"google.golang.org/api/iterator"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Period Comparison
+
+************************************************/
+
+// priorFolder is the folder of an earlier period which holds the CSVs a
+// report folder is compared with, e.g. previous week. Fetched holds the CSVs
+// the report fetched because the folder did not have them.
+type priorFolder struct {
+	Name    string
+	Folder  string
+	Fetched string
+}
+
+// seriesDelta compares the statistics of a series with an earlier period
+type seriesDelta struct {
+	Comparison string
+	Name       string
+	Current    analysis.Stats
+	Prior      analysis.Stats
+}
+
+// Base paths of the periods a report is compared with
+func priorBasePaths(projectID string, p period.Period) []priorFolder {
+	var priors []priorFolder
+	for _, comparison := range p.Comparisons() {
+		priors = append(priors, priorFolder{
+			Name:    comparison.Name,
+			Folder:  basePathOfReportStuff(projectID, comparison.Period),
+			Fetched: fetchedPriorPath(basePathOfReportStuff(projectID, p), comparison.Period),
+		})
+	}
+
+	return priors
+}
+
+// Prior CSVs fetched for a report stay in its own folder, e.g.
+// <base_path>/priors/2018-09, the folders of other periods are not touched
+func fetchedPriorPath(basePath string, prior period.Period) string {
+	return fmt.Sprintf("%s/priors/%s", basePath, prior.Label())
+}
+
+// The same sub folder, e.g. cloudsql, under the base paths of the priors
+func priorFoldersOf(basePath, folder string, priors []priorFolder) []priorFolder {
+	folders := make([]priorFolder, len(priors))
+	for i, prior := range priors {
+		folders[i] = priorFolder{
+			Name:    prior.Name,
+			Folder:  prior.Folder + strings.TrimPrefix(folder, basePath),
+			Fetched: prior.Fetched + strings.TrimPrefix(folder, basePath),
+		}
+	}
+
+	return folders
+}
+
+// Summaries of a prior folder, completed by the fetched ones of the
+// instances and metrics the folder does not have
+func (g *GCSExporter) priorSummaries(ctx context.Context, bh *storage.BucketHandle, compared []utils.MetricConf, prior priorFolder) map[string]map[string][]seriesSummary {
+	summaries := summarizeSeries(g.loadSectionSeries(ctx, bh, compared, g.getCSVPathMaps(ctx, bh, prior.Folder)))
+	fetched := summarizeSeries(g.loadSectionSeries(ctx, bh, compared, g.getCSVPathMaps(ctx, bh, prior.Fetched)))
+
+	for instanceName, fetchedMap := range fetched {
+		if _, ok := summaries[instanceName]; !ok {
+			summaries[instanceName] = make(map[string][]seriesSummary)
+		}
+		for metricName, fetchedList := range fetchedMap {
+			if _, ok := summaries[instanceName][metricName]; !ok {
+				summaries[instanceName][metricName] = fetchedList
+			}
+		}
+	}
+
+	return summaries
+}
+
+func comparedMetrics(metrics []utils.MetricConf) (compared []utils.MetricConf) {
+	for _, metric := range metrics {
+		if metric.Compare {
+			compared = append(compared, metric)
+		}
+	}
+
+	return
+}
+
+// Deltas of each instance keyed by metric name. A series is compared with the
+// series of the same name in every prior folder that has it.
+func (g *GCSExporter) compareSeries(ctx context.Context, bh *storage.BucketHandle, metrics []utils.MetricConf, summaries map[string]map[string][]seriesSummary, priors []priorFolder) map[string]map[string][]seriesDelta {
+	deltas := make(map[string]map[string][]seriesDelta)
+
+	compared := comparedMetrics(metrics)
+	if len(compared) == 0 {
+		return deltas
+	}
+
+	for _, prior := range priors {
+		priorSummaries := g.priorSummaries(ctx, bh, compared, prior)
+
+		for instanceName, priorMap := range priorSummaries {
+			for metricName, priorList := range priorMap {
+				for _, current := range summaries[instanceName][metricName] {
+					for _, previous := range priorList {
+						if previous.Name != current.Name {
+							continue
+						}
+
+						if _, ok := deltas[instanceName]; !ok {
+							deltas[instanceName] = make(map[string][]seriesDelta)
+						}
+						deltas[instanceName][metricName] = append(deltas[instanceName][metricName], seriesDelta{
+							Comparison: prior.Name,
+							Name:       current.Name,
+							Current:    current.Stats,
+							Prior:      previous.Stats,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return deltas
+}
+
+// e.g. +12.3%, n/a when the prior value is zero or either one is NaN
+func changeOf(current, prior float64) string {
+	if prior == 0 || math.IsNaN(prior) || math.IsNaN(current) {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%+.1f%%", (current-prior)/prior*100)
+}
+
+// e.g. vs previous week: mean + 0.143 cores (+12.3%), p95 + 0.410 cores (-5.0%)
+func writeComparisons(pdf *gofpdf.Fpdf, metric utils.MetricConf, deltas []seriesDelta) {
+	if len(deltas) == 0 {
+		return
+	}
+
+	formatter := utils.GetValueFormatter(metric.Unit)
+	format := func(v float64) string {
+		return strings.TrimSpace(formatter(v))
+	}
+
+	pdf.SetFont("Times", "", 10)
+	for _, delta := range deltas {
+		subject := "vs " + delta.Comparison
+		if delta.Name != "" {
+			subject = fmt.Sprintf("%s %s", delta.Name, subject)
+		}
+
+		pdf.CellFormat(0, 5, fmt.Sprintf("%s: mean %s (%s), p95 %s (%s)",
+			subject,
+			format(delta.Current.Mean), changeOf(delta.Current.Mean, delta.Prior.Mean),
+			format(delta.Current.P95), changeOf(delta.Current.P95, delta.Prior.P95),
+		), "", 1, "L", false, 0, "")
+	}
+	pdf.SetFont("Times", "B", 16)
+}
+
+// HasMetrics tells whether the CSV of a metric is in the bucket for an
+// instance. Metrics split by FolderBy or NameBy are named after label values
+// and are not looked up.
+func (g *GCSExporter) HasMetrics(p period.Period, projectID string, metric utils.MetricConf, instanceName string) bool {
+	return g.hasMetricsIn(basePathOfReportStuff(projectID, p), p.Label(), metric, instanceName)
+}
+
+// HasPriorMetrics tells whether the CSV of a metric of a prior period is in
+// its folder or was already fetched for the report of p
+func (g *GCSExporter) HasPriorMetrics(p, prior period.Period, projectID string, metric utils.MetricConf, instanceName string) bool {
+	return g.HasMetrics(prior, projectID, metric, instanceName) ||
+		g.hasMetricsIn(fetchedPriorPath(basePathOfReportStuff(projectID, p), prior), prior.Label(), metric, instanceName)
+}
+
+func (g *GCSExporter) hasMetricsIn(basePath, label string, metric utils.MetricConf, instanceName string) bool {
+	ctx := context.Background()
+	folder := resourceFolder(basePath, metric.Resource, instanceName)
+	prefix := fmt.Sprintf("%s/%s[%s][%s]", folder, label, instanceName, metric.Name)
+
+	it := g.bucket(ctx).Objects(ctx, &storage.Query{Prefix: prefix})
+	_, err := it.Next()
+	if err == iterator.Done {
+		return false
+	}
+	if err != nil {
+		log.Fatalf("Failed to list files: %v", err)
+	}
+
+	return true
+}
+
+// ExportPriorMetrics saves the series of a prior period fetched for the
+// report of p
+func (g *GCSExporter) ExportPriorMetrics(p, prior period.Period, projectID string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints) {
+	g.exportMetricsTo(fetchedPriorPath(basePathOfReportStuff(projectID, p), prior), prior, metric, instanceName, series)
+}
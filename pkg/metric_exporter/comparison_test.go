@@ -0,0 +1,74 @@
+package metric_exporter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+)
+
+func TestChangeOf(t *testing.T) {
+	tests := []struct {
+		current float64
+		prior   float64
+		expect  string
+	}{
+		{112.3, 100, "+12.3%"},
+		{95, 100, "-5.0%"},
+		{5, 5, "+0.0%"},
+		{0, 0, "n/a"},
+		{5, 0, "n/a"},
+		{5, math.NaN(), "n/a"},
+		{math.NaN(), 5, "n/a"},
+	}
+
+	for _, test := range tests {
+		if got := changeOf(test.current, test.prior); got != test.expect {
+			t.Errorf("changeOf(%v, %v): expect %s, got %s", test.current, test.prior, test.expect, got)
+		}
+	}
+}
+
+func TestPriorBasePaths(t *testing.T) {
+	c := period.Calendar{}
+	october := c.Of(period.Monthly, time.Date(2018, 10, 15, 0, 0, 0, 0, time.UTC))
+	interval := period.Period{Range: period.Monthly, Start: time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC), End: time.Date(2018, 10, 20, 0, 0, 0, 0, time.UTC), Calendar: c}
+
+	tests := []struct {
+		name   string
+		p      period.Period
+		expect []priorFolder
+	}{
+		{"monthly", october, []priorFolder{
+			{"previous month", "demo/2018/monthly/2018-09", "demo/2018/monthly/2018-10/priors/2018-09"},
+			{"same month last year", "demo/2017/monthly/2017-10", "demo/2018/monthly/2018-10/priors/2017-10"},
+		}},
+		{"weekly", c.Of(period.Weekly, time.Date(2018, 10, 31, 0, 0, 0, 0, time.UTC)), []priorFolder{
+			{"previous week", "demo/2018/weekly/2018-1021-1028", "demo/2018/weekly/2018-1028-1104/priors/2018-1021-1028"},
+		}},
+		// Never the folders of the regular months
+		{"explicit interval", interval, []priorFolder{
+			{"previous month", "demo/2018/monthly/2018-0920-1005", "demo/2018/monthly/2018-1005-1020/priors/2018-0920-1005"},
+			{"same month last year", "demo/2017/monthly/2017-1005-1020", "demo/2018/monthly/2018-1005-1020/priors/2017-1005-1020"},
+		}},
+	}
+
+	for _, test := range tests {
+		priors := priorBasePaths("demo", test.p)
+		if len(priors) != len(test.expect) {
+			t.Fatalf("%s: expect %d priors, got %+v", test.name, len(test.expect), priors)
+		}
+		for i, e := range test.expect {
+			if priors[i] != e {
+				t.Errorf("%s: expect %+v, got %+v", test.name, e, priors[i])
+			}
+		}
+	}
+
+	// Sub folders keep their place under every prior
+	folders := priorFoldersOf("demo/2018/monthly/2018-10", "demo/2018/monthly/2018-10/cloudsql", priorBasePaths("demo", october))
+	if folders[0].Folder != "demo/2018/monthly/2018-09/cloudsql" || folders[0].Fetched != "demo/2018/monthly/2018-10/priors/2018-09/cloudsql" {
+		t.Errorf("expect the cloudsql folders of 2018-09, got %+v", folders[0])
+	}
+}
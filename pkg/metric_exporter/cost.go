@@ -0,0 +1,238 @@
+package metric_exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+)
+
+/************************************************
+
+Cost Estimate
+
+************************************************/
+
+// instanceCost is the estimated cost of one instance of the inventory,
+// Priced is false when the pricing file has no price for it
+type instanceCost struct {
+	Instance gcp.Instance
+	Priced   bool
+	Cost     analysis.Cost
+}
+
+// Share of the size a downsize keeps, e.g. 0.5 from 4 to 2 vCPUs
+func downsizeKeep(r analysis.Recommendation, instance gcp.Instance) float64 {
+	if r.Action != analysis.ActionDownsize || instance.CPUs == 0 || instance.MemoryMB == 0 {
+		return 1
+	}
+
+	return math.Min(1, math.Max(float64(r.SuggestedCPUs)/float64(instance.CPUs), float64(r.SuggestedMemoryMB)/float64(instance.MemoryMB)))
+}
+
+// Costs of the instances of the inventory which ran in the period, the
+// uptime is the one of their CPU series in the GCE chapter. The savings of
+// a downsize come from the rightsizing recommendations. The most expensive
+// instances come first, those without price last.
+func (g *GCSExporter) estimateCosts(p period.Period, chapters []reportChapter, inventory []gcp.Instance, recommendations []instanceRecommendation) (costs []instanceCost) {
+	var seriesMaps map[string]map[string][]SeriesValues
+	for _, chapter := range chapters {
+		if chapter.Resource == stackdriver.ResourceGCEInstance && len(chapter.Sections) > 0 {
+			seriesMaps = chapter.Sections[0].Series
+		}
+	}
+	if seriesMaps == nil {
+		return
+	}
+
+	step := g.costStep(p)
+	keeps := make(map[string]float64)
+	for _, r := range recommendations {
+		keeps[r.Instance.Key()] = downsizeKeep(r.Recommendation, r.Instance)
+	}
+
+	for _, instance := range inventory {
+		cpu := seriesMaps[fmt.Sprintf("[%s]", instance.Key())][g.Cost.CPUMetric]
+		if len(cpu) == 0 || len(cpu[0].XValues) == 0 {
+			continue
+		}
+
+		hourly, ok := g.Cost.Pricing.HourlyOf(instance.MachineType, instance.Region(), instance.CPUs, instance.MemoryMB)
+		keep, recommended := keeps[instance.Key()]
+		if !recommended {
+			keep = 1
+		}
+
+		costs = append(costs, instanceCost{
+			Instance: instance,
+			Priced:   ok,
+			Cost:     analysis.EstimateCost(cpu[0].XValues, cpu[0].YValues, step, instance.CPUs, hourly, g.Cost.IdleBelow, keep),
+		})
+	}
+
+	sort.SliceStable(costs, func(i, j int) bool {
+		if costs[i].Priced != costs[j].Priced {
+			return costs[i].Priced
+		}
+		return costs[i].Cost.Cost > costs[j].Cost.Cost
+	})
+
+	return
+}
+
+// Alignment period of the CPU metric in the range of p
+func (g *GCSExporter) costStep(p period.Period) time.Duration {
+	for _, metric := range g.Metrics {
+		if metric.Name == g.Cost.CPUMetric {
+			return stackdriver.Aggregation{AlignmentPeriod: metric.AlignmentPeriodOf(p.Range, p.AlignmentPeriod())}.Step()
+		}
+	}
+
+	return 0
+}
+
+// Sum of the priced instances
+func totalCost(costs []instanceCost) (total analysis.Cost) {
+	for _, c := range costs {
+		if !c.Priced {
+			continue
+		}
+
+		total.UptimeHours += c.Cost.UptimeHours
+		total.Cost += c.Cost.Cost
+		total.IdleHours += c.Cost.IdleHours
+		total.IdleCost += c.Cost.IdleCost
+		total.Savings += c.Cost.Savings
+	}
+
+	return
+}
+
+var costTableHeader = []string{"Instance", "Machine type", "Hourly", "Uptime (h)", "Cost", "Idle cost", "Savings"}
+
+var costTableWidths = []float64{50, 28, 20, 20, 24, 24, 24}
+
+// The project totals, then a table of every instance
+func (g *GCSExporter) writeCosts(pdf *gofpdf.Fpdf, costs []instanceCost) {
+	if len(costs) == 0 {
+		return
+	}
+
+	currency := g.Cost.Pricing.Currency
+	money := func(v float64) string {
+		return fmt.Sprintf("%.2f %s", v, currency)
+	}
+	total := totalCost(costs)
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(0, 10, "Cost Estimate", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Times", "", 12)
+	pdf.CellFormat(0, 6, fmt.Sprintf("Estimated cost %s, idle %s, potential savings %s", money(total.Cost), money(total.IdleCost), money(total.Savings)), "", 1, "L", false, 0, "")
+	pdf.SetFont("Times", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("Idle hours have a CPU utilization below %.0f%%, savings add the idle cost and the cost a downsize saves.", g.Cost.IdleBelow*100), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	pdf.SetFont("Times", "B", 9)
+	for i, title := range costTableHeader {
+		pdf.CellFormat(costTableWidths[i], 6, title, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Times", "", 9)
+	for _, c := range costs {
+		row := []string{
+			fmt.Sprintf("%s (%s)", c.Instance.Name, c.Instance.Zone),
+			c.Instance.MachineType,
+			"no price",
+			fmt.Sprintf("%.0f", c.Cost.UptimeHours),
+			"", "", "",
+		}
+		if c.Priced {
+			row[2] = fmt.Sprintf("%.4f", c.Cost.Hourly)
+			row[4] = fmt.Sprintf("%.2f", c.Cost.Cost)
+			row[5] = fmt.Sprintf("%.2f", c.Cost.IdleCost)
+			row[6] = fmt.Sprintf("%.2f", c.Cost.Savings)
+		}
+
+		for i, value := range row {
+			align := "R"
+			if i < 2 {
+				align = "L"
+			}
+			pdf.CellFormat(costTableWidths[i], 6, value, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+/************************************************
+
+Cost Estimate(CSV)
+
+************************************************/
+
+var costCSVHeader = []string{"instance", "name", "zone", "region", "machine_type", "currency", "hourly", "uptime_hours", "cost", "idle_hours", "idle_cost", "savings"}
+
+func costPath(basePath string) string {
+	return fmt.Sprintf("%s/cost.csv", basePath)
+}
+
+// Amounts are empty for the instances without price, the last row is the
+// total of the priced ones
+func (g *GCSExporter) saveCostsToCSV(filename string, costs []instanceCost) {
+	currency := g.Cost.Pricing.Currency
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(costCSVHeader)
+	for _, c := range costs {
+		hourly, cost, idleCost, savings := "", "", "", ""
+		if c.Priced {
+			hourly = fmt.Sprintf("%f", c.Cost.Hourly)
+			cost = fmt.Sprintf("%f", c.Cost.Cost)
+			idleCost = fmt.Sprintf("%f", c.Cost.IdleCost)
+			savings = fmt.Sprintf("%f", c.Cost.Savings)
+		}
+
+		cw.Write([]string{
+			c.Instance.Key(),
+			c.Instance.Name,
+			c.Instance.Zone,
+			c.Instance.Region(),
+			c.Instance.MachineType,
+			currency,
+			hourly,
+			fmt.Sprintf("%f", c.Cost.UptimeHours),
+			cost,
+			fmt.Sprintf("%f", c.Cost.IdleHours),
+			idleCost,
+			savings,
+		})
+	}
+
+	total := totalCost(costs)
+	cw.Write([]string{
+		"total", "", "", "", "",
+		currency,
+		"",
+		fmt.Sprintf("%f", total.UptimeHours),
+		fmt.Sprintf("%f", total.Cost),
+		fmt.Sprintf("%f", total.IdleHours),
+		fmt.Sprintf("%f", total.IdleCost),
+		fmt.Sprintf("%f", total.Savings),
+	})
+	cw.Flush()
+
+	g.writeObject(filename, &buf)
+}
@@ -0,0 +1,141 @@
+package metric_exporter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+)
+
+/************************************************
+
+Export Tasks
+
+************************************************/
+
+// Every run of the stuff job has its own folder, e.g.
+// <base_path>/tasks/1541030400000000000, with one object per finished export
+// task. The enqueued file names the last run and its number of tasks.
+func exportTasksPath(basePath string) string {
+	return fmt.Sprintf("%s/tasks", basePath)
+}
+
+func enqueuedTasksPath(basePath string) string {
+	return fmt.Sprintf("%s/enqueued", exportTasksPath(basePath))
+}
+
+func (g *GCSExporter) ExportTasksEnqueued(p period.Period, projectID, run string, tasks int) {
+	content := fmt.Sprintf("%s,%d", run, tasks)
+	g.writeObject(enqueuedTasksPath(basePathOfReportStuff(projectID, p)), strings.NewReader(content))
+}
+
+// The done object of a task holds the list stats of its export
+func (g *GCSExporter) ExportTaskDone(p period.Period, projectID, run, task string, stats stackdriver.ListStats) {
+	filename := fmt.Sprintf("%s/%s/%s", exportTasksPath(basePathOfReportStuff(projectID, p)), run, task)
+	g.writeObject(filename, strings.NewReader(listStatsCSV([]stackdriver.ListStats{stats})))
+}
+
+// The last run of the stuff job and its number of tasks, ok is false when the
+// stuff job did not record it
+func lastRun(ctx context.Context, bh *storage.BucketHandle, basePath string) (run string, tasks int, ok bool) {
+	r, err := bh.Object(enqueuedTasksPath(basePath)).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read enqueued tasks: %v", err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		log.Fatalf("Failed to read enqueued tasks: %v", err)
+	}
+	fields := strings.Split(strings.TrimSpace(string(data)), ",")
+	if len(fields) != 2 {
+		log.Fatalf("Failed to parse enqueued tasks %q", data)
+	}
+	tasks, err = strconv.Atoi(fields[1])
+	if err != nil {
+		log.Fatalf("Failed to parse enqueued tasks %q", data)
+	}
+
+	return fields[0], tasks, true
+}
+
+// Names of the done objects of the tasks of a run
+func doneTasks(ctx context.Context, bh *storage.BucketHandle, basePath, run string) (names []string) {
+	it := bh.Objects(ctx, &storage.Query{Prefix: fmt.Sprintf("%s/%s/", exportTasksPath(basePath), run)})
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Failed to list files: %v", err)
+		}
+		names = append(names, objAttrs.Name)
+	}
+
+	return
+}
+
+// Every export task of the last run finished. Stuff without the enqueued
+// file has nothing to wait for.
+func (g *GCSExporter) HasAllStuff(p period.Period, projectID string) bool {
+	ctx := context.Background()
+	bh := g.bucket(ctx)
+	basePath := basePathOfReportStuff(projectID, p)
+
+	run, tasks, ok := lastRun(ctx, bh, basePath)
+	if !ok {
+		return true
+	}
+	done := len(doneTasks(ctx, bh, basePath, run))
+
+	log.Printf("HasAllStuff: %d of %d export task(s) of %s finished", done, tasks, basePath)
+
+	return done >= tasks
+}
+
+// List stats of the export tasks of the last run summed by metric, in the
+// order of the catalog
+func (g *GCSExporter) loadExportStats(ctx context.Context, bh *storage.BucketHandle, basePath string) (listStats []stackdriver.ListStats) {
+	run, _, ok := lastRun(ctx, bh, basePath)
+	if !ok {
+		return
+	}
+
+	for _, name := range doneTasks(ctx, bh, basePath, run) {
+		r, err := bh.Object(name).NewReader(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", name, err)
+		}
+		for _, stats := range parseListStats(r) {
+			// A task of a metric no longer in the catalog read nothing
+			if stats.Metric != "" {
+				listStats = stackdriver.AddListStats(listStats, stats)
+			}
+		}
+		r.Close()
+	}
+
+	order := make(map[string]int)
+	for i, metric := range g.Metrics {
+		order[metric.Name] = i
+	}
+	sort.SliceStable(listStats, func(i, j int) bool {
+		return order[listStats[i].Metric] < order[listStats[j].Metric]
+	})
+
+	return
+}
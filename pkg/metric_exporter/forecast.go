@@ -0,0 +1,249 @@
+package metric_exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+
+	"stackdriver-monitoring-simple-reporter/pkg/gcp"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Capacity Forecast
+
+************************************************/
+
+var forecastLevelColor = drawing.Color{R: 255, G: 140, B: 0, A: 255}
+
+// Memory of the machine types in bytes, keyed like the image readers
+func instanceMemories(instances []gcp.Instance) map[string]float64 {
+	memories := make(map[string]float64)
+	for _, instance := range instances {
+		if instance.MemoryMB > 0 {
+			memories[fmt.Sprintf("[%s]", instance.Key())] = float64(instance.MemoryMB) * 1024 * 1024
+		}
+	}
+
+	return memories
+}
+
+// Capacity of the series of an instance, false when it is not known
+func capacityOf(metric utils.MetricConf, key string, memories map[string]float64) (float64, bool) {
+	if metric.CapacityOf == utils.CapacityMachineMemory {
+		memory, ok := memories[key]
+		return memory, ok
+	}
+
+	return metric.Capacity, metric.Capacity > 0
+}
+
+// The machine memory comes from the inventory, which the stuff job saves
+// before it enqueues the export tasks
+func (g *GCSExporter) chartCapacity(p period.Period, basePath string, metric utils.MetricConf, instanceName string) (float64, bool) {
+	if !g.Forecast.Enabled(p.Range) || !metric.Projected() {
+		return 0, false
+	}
+
+	var memories map[string]float64
+	if metric.CapacityOf == utils.CapacityMachineMemory {
+		ctx := context.Background()
+		memories = instanceMemories(g.loadInventory(ctx, g.bucket(ctx), basePath))
+	}
+
+	return capacityOf(metric, fmt.Sprintf("[%s]", instanceName), memories)
+}
+
+// Dashed projections of the series one period ahead, with the forecast level
+// of the capacity when it is known. The projected times extend the ticks.
+func (g *GCSExporter) forecastSeries(p period.Period, metric utils.MetricConf, series []stackdriver.TimeSeriesPoints, capacity float64, hasCapacity bool) (forecasts []chart.Series, projectedX []time.Time) {
+	if !g.Forecast.Enabled(p.Range) || !metric.Projected() {
+		return
+	}
+
+	end := p.End.Add(p.End.Sub(p.Start))
+	for i, s := range series {
+		var xs []time.Time
+		var ys []float64
+		for j := range s.XValues {
+			if j < len(s.Valid) && s.Valid[j] {
+				xs = append(xs, s.XValues[j])
+				ys = append(ys, s.YValues[j])
+			}
+		}
+
+		forecast, ok := g.Forecast.Project(xs, ys)
+		if !ok {
+			continue
+		}
+		forecast = forecast.Until(end)
+		if len(forecast.XValues) == 0 {
+			continue
+		}
+
+		if len(forecast.XValues) > len(projectedX) {
+			projectedX = forecast.XValues
+		}
+		forecasts = append(forecasts, chart.TimeSeries{
+			Name:    forecastName(s.Name),
+			XValues: forecast.XValues,
+			YValues: forecast.YValues,
+			Style: chart.Style{
+				Show:            true,
+				StrokeColor:     seriesColor(i, len(series)),
+				StrokeDashArray: []float64{5.0, 5.0},
+			},
+		})
+	}
+
+	if hasCapacity && len(forecasts) > 0 {
+		level := g.Forecast.Level * capacity
+		forecasts = append(forecasts, chart.TimeSeries{
+			Name:    fmt.Sprintf("%.0f%% of capacity", g.Forecast.Level*100),
+			XValues: []time.Time{series[0].XValues[0], projectedX[len(projectedX)-1]},
+			YValues: []float64{level, level},
+			Style: chart.Style{
+				Show:            true,
+				StrokeColor:     forecastLevelColor,
+				StrokeDashArray: []float64{2.0, 2.0},
+			},
+		})
+	}
+
+	return
+}
+
+func forecastName(name string) string {
+	if name == "" {
+		return "forecast"
+	}
+
+	return name + " forecast"
+}
+
+// seriesForecast is when a series is projected to reach the forecast level
+// of its capacity
+type seriesForecast struct {
+	Name  string
+	Value float64
+	Reach time.Time
+}
+
+// Forecasts of each instance keyed by metric name, for the series projected
+// to reach the level within the horizon
+func (g *GCSExporter) projectSeries(metrics []utils.MetricConf, seriesMaps map[string]map[string][]SeriesValues, memories map[string]float64) map[string]map[string][]seriesForecast {
+	forecasts := make(map[string]map[string][]seriesForecast)
+
+	for instanceName, seriesMap := range seriesMaps {
+		for _, metric := range metrics {
+			capacity, ok := capacityOf(metric, instanceName, memories)
+			if !ok {
+				continue
+			}
+
+			value := g.Forecast.Level * capacity
+			for _, series := range seriesMap[metric.Name] {
+				forecast, ok := g.Forecast.Project(series.XValues, series.YValues)
+				if !ok {
+					continue
+				}
+				reach, ok := forecast.Reach(value)
+				if !ok {
+					continue
+				}
+
+				if _, ok := forecasts[instanceName]; !ok {
+					forecasts[instanceName] = make(map[string][]seriesForecast)
+				}
+				forecasts[instanceName][metric.Name] = append(forecasts[instanceName][metric.Name], seriesForecast{
+					Name:  series.Name,
+					Value: value,
+					Reach: reach,
+				})
+			}
+		}
+	}
+
+	return forecasts
+}
+
+// e.g. Memory Bytes Used projected to reach 90% (13.50GiB) on 2018/12/03
+func (g *GCSExporter) forecastMessage(metric utils.MetricConf, forecast seriesForecast) string {
+	name := forecast.Name
+	if name == "" {
+		name = metric.Title
+	}
+
+	return fmt.Sprintf("%s projected to reach %.0f%% (%s) on %s", name, g.Forecast.Level*100, utils.GetValueFormatter(metric.Unit)(forecast.Value), forecast.Reach.Format("2006/01/02"))
+}
+
+func (g *GCSExporter) writeForecasts(pdf *gofpdf.Fpdf, metric utils.MetricConf, forecasts []seriesForecast) {
+	if len(forecasts) == 0 {
+		return
+	}
+
+	pdf.SetFont("Times", "", 12)
+	pdf.SetTextColor(200, 100, 0)
+	for _, forecast := range forecasts {
+		pdf.CellFormat(0, 6, g.forecastMessage(metric, forecast), "", 1, "C", false, 0, "")
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Times", "B", 16)
+}
+
+// reportForecast is a forecast with the chart it is on
+type reportForecast struct {
+	Name     string
+	Metric   utils.MetricConf
+	Forecast seriesForecast
+}
+
+// Every forecast of the report, the earliest first
+func reportForecasts(chapters []reportChapter) (forecasts []reportForecast) {
+	for _, chapter := range chapters {
+		for _, section := range chapter.Sections {
+			for _, key := range section.Keys {
+				for _, metric := range chapter.Metrics {
+					for _, forecast := range section.Forecasts[key][metric.Name] {
+						forecasts = append(forecasts, reportForecast{
+							Name:     displayName(key, section.Names),
+							Metric:   metric,
+							Forecast: forecast,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(forecasts, func(i, j int) bool {
+		return forecasts[i].Forecast.Reach.Before(forecasts[j].Forecast.Reach)
+	})
+
+	return
+}
+
+// e.g. web-1 (asia-east1-a)  Memory Bytes Used projected to reach 90% (13.50GiB) on 2018/12/03
+func (g *GCSExporter) writeCapacityForecasts(pdf *gofpdf.Fpdf, forecasts []reportForecast) {
+	if len(forecasts) == 0 {
+		return
+	}
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(0, 10, "Capacity Forecast", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Times", "", 10)
+	for _, f := range forecasts {
+		pdf.CellFormat(55, 6, f.Name, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, g.forecastMessage(f.Metric, f.Forecast), "", 1, "L", false, 0, "")
+	}
+}
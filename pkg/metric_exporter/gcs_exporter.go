@@ -2,13 +2,16 @@ package metric_exporter
 
 import (
 	"context"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,7 +19,10 @@ import (
 	"google.golang.org/api/iterator"
 	"google.golang.org/appengine/mail"
 
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp"
 	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
 	"stackdriver-monitoring-simple-reporter/pkg/utils"
 
 	"cloud.google.com/go/storage"
@@ -27,101 +33,326 @@ import (
 )
 
 type GCSExporter struct {
-	BucketName string
-	ReportName string
-	ReportPath string
+	BucketName  string
+	ReportName  string
+	ReportPath  string
+	Metrics     []utils.MetricConf
+	Selections  utils.Selections
+	Rightsizing utils.RightsizingConf
+	Anomalies   utils.AnomalyConf
+	Forecast    utils.ForecastConf
+	Heatmaps    utils.HeatmapConf
+	Ranking     utils.RankingConf
+	Cost        utils.CostConf
+	Location    *time.Location
+
+	client *storage.Client
 }
 
 func NewGCSExporter(c utils.Conf) MetricExporter {
 	exporter := &GCSExporter{}
 	exporter.BucketName = c.Destination
+	exporter.Metrics = c.Metrics
+	exporter.Selections = c.Selections
+	exporter.Rightsizing = c.Rightsizing
+	exporter.Anomalies = c.Anomalies
+	exporter.Forecast = c.Forecast
+	exporter.Heatmaps = c.Heatmaps
+	exporter.Ranking = c.Ranking
+	exporter.Cost = c.Cost
+	exporter.Location = c.Location()
 
 	return exporter
 }
 
-func (g *GCSExporter) saveTimeSeriesToCSV(filename string, metricPoints []string) {
-	content := fmt.Sprintf("%s\n%s", stackdriver.PointCSVHeader, strings.Join(metricPoints, "\n"))
-	r := strings.NewReader(content)
+// The storage client is created once and shared by every read and write
+func (g *GCSExporter) bucket(ctx context.Context) *storage.BucketHandle {
+	if g.client == nil {
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			log.Fatalf("Failed to create client: %v", err)
+		}
+		g.client = client
+	}
 
+	return g.client.Bucket(g.BucketName)
+}
+
+func (g *GCSExporter) writeObject(filename string, r io.Reader) {
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	w := g.bucket(ctx).Object(filename).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		log.Fatalf("Failed to export %s: %v", filename, err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatalf("Failed to export %s(Close buffer): %v", filename, err)
+	}
+}
+
+func (g *GCSExporter) saveTimeSeriesToCSV(filename string, header string, metricPoints []string) {
+	content := fmt.Sprintf("%s\n%s", header, strings.Join(metricPoints, "\n"))
+	g.writeObject(filename, strings.NewReader(content))
+}
+
+/************************************************
+
+List Stats(CSV)
+
+************************************************/
+
+// Rows without source were saved before the sources, by the discovery
+func listStatsCSV(listStats []stackdriver.ListStats) string {
+	lines := make([]string, len(listStats))
+	for i, stats := range listStats {
+		lines[i] = fmt.Sprintf("%s,%d,%d,%s", stats.Metric, stats.Pages, stats.TimeSeries, stats.Source)
+	}
+
+	return fmt.Sprintf("%s\n%s", stackdriver.ListStatsCSVHeader, strings.Join(lines, "\n"))
+}
+
+func parseListStats(r io.Reader) (listStats []stackdriver.ListStats) {
+	records, err := csv.NewReader(r).ReadAll()
 	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+		log.Fatalf("Failed to parse list stats: %v", err)
 	}
 
-	bh := client.Bucket(g.BucketName)
-	obj := bh.Object(filename)
-	w := obj.NewWriter(ctx)
-	if _, err := io.Copy(w, r); err != nil {
-		log.Fatalf("Failed to export metrics to csv: %v", err)
+	// Skip header
+	for i := 1; i < len(records); i++ {
+		pages, _ := strconv.Atoi(records[i][1])
+		timeSeries, _ := strconv.Atoi(records[i][2])
+		source := stackdriver.ListSourceDiscovery
+		if len(records[i]) > 3 {
+			source = records[i][3]
+		}
+		listStats = append(listStats, stackdriver.ListStats{
+			Metric:     records[i][0],
+			Pages:      pages,
+			TimeSeries: timeSeries,
+			Source:     source,
+		})
 	}
-	if err := w.Close(); err != nil {
-		log.Fatalf("Failed to export metrics to csv(Close buffer): %v", err)
+
+	return
+}
+
+func (g *GCSExporter) saveListStatsToCSV(filename string, listStats []stackdriver.ListStats) {
+	g.writeObject(filename, strings.NewReader(listStatsCSV(listStats)))
+}
+
+// Missing file means the stuff job did not record list stats
+func (g *GCSExporter) loadListStats(ctx context.Context, bh *storage.BucketHandle, basePath string) (listStats []stackdriver.ListStats) {
+	r, err := bh.Object(listStatsPath(basePath)).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read list stats: %v", err)
 	}
+	defer r.Close()
+
+	return parseListStats(r)
 }
 
-func getValueFormat(metric string) chart.ValueFormatter {
-	if "compute.googleapis.com/instance/cpu/usage_time" == metric {
-		return utils.CPUValueFormatter
+// The discovery stats of the stuff job, the stats of the export tasks of its
+// last run and the comparison stats of every report job, saved back to the
+// list stats once the report adds to them
+func (g *GCSExporter) reportListStats(ctx context.Context, bh *storage.BucketHandle, basePath string, comparisonStats []stackdriver.ListStats) []stackdriver.ListStats {
+	loaded := g.loadListStats(ctx, bh, basePath)
+	exportStats := g.loadExportStats(ctx, bh, basePath)
+
+	var listStats, comparisons []stackdriver.ListStats
+	for _, stats := range loaded {
+		switch {
+		case stats.Source == stackdriver.ListSourceComparison:
+			comparisons = append(comparisons, stats)
+		case stats.Source == stackdriver.ListSourceExport && len(exportStats) > 0:
+		default:
+			listStats = append(listStats, stats)
+		}
+	}
+	for _, stats := range comparisonStats {
+		comparisons = stackdriver.AddListStats(comparisons, stats)
+	}
+	listStats = append(append(listStats, exportStats...), comparisons...)
+
+	if len(loaded) > 0 && (len(exportStats) > 0 || len(comparisonStats) > 0) {
+		g.saveListStatsToCSV(listStatsPath(basePath), listStats)
 	}
-	return utils.MemoryValueFormatter
+
+	return listStats
+}
+
+func listStatsPath(basePath string) string {
+	return fmt.Sprintf("%s/list_stats.csv", basePath)
+}
+
+func (g *GCSExporter) ExportListStats(p period.Period, projectID string, listStats []stackdriver.ListStats) {
+	g.saveListStatsToCSV(listStatsPath(basePathOfReportStuff(projectID, p)), listStats)
 }
 
 /************************************************
 
-Weekly Report(CSV)
+Existing Outputs
 
 ************************************************/
 
-//
-// <destination>/
-// └── <project_id>
-//     └── 2018
-//         └── weekly
-//             └── 2018-1028-1104
-//                 ├── 2018-1028-1104[instance_name][cpu_usage_time].csv
-//  							 └── 2018-1028-1104[instance_name][memory_bytes_used].csv
-//
-func (g *GCSExporter) ExportWeeklyMetrics(startDate time.Time, projectID, metric, instanceName string, metricPoints []string) {
-	endDate := startDate.AddDate(0, 0, 7)
-	weekStr := fmt.Sprintf("%d-%02d%02d-%02d%02d", startDate.Year(), startDate.Month(), startDate.Day(), endDate.Month(), endDate.Day())
-	folder := fmt.Sprintf("%s/%d/weekly/%s", projectID, startDate.Year(), weekStr)
+func (g *GCSExporter) objectExists(filename string) bool {
+	ctx := context.Background()
+	_, err := g.bucket(ctx).Object(filename).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return false
+	}
+	if err != nil {
+		log.Fatalf("Failed to check %s: %v", filename, err)
+	}
 
-	title := strings.Replace(metric, "compute.googleapis.com/instance/", "", -1)
-	title = strings.Replace(title, "agent.googleapis.com/", "", -1)
-	title = strings.Replace(title, "/", "_", -1)
+	return true
+}
+
+// The list stats are saved once the stuff job enqueued every export
+func (g *GCSExporter) HasStuff(p period.Period, projectID string) bool {
+	return g.objectExists(listStatsPath(basePathOfReportStuff(projectID, p)))
+}
 
-	output := fmt.Sprintf("%s/%s-%s[%s][%s].csv", folder, startDate.Format("2006-0102"), endDate.Format("0102"), instanceName, title)
+func (g *GCSExporter) HasReport(projectID string, p period.Period) bool {
+	return g.objectExists(fmt.Sprintf("%s/%s", basePathOfReportStuff(projectID, p), reportName(projectID, p)))
+}
+
+const (
+	cloudSQLFolder = "cloudsql"
+	gkeFolder      = "gke"
+)
 
-	g.saveTimeSeriesToCSV(output, metricPoints)
+// PDF chapter of each resource type, a GKE chapter is titled by its cluster
+var resourceTitles = map[string]string{
+	stackdriver.ResourceGCEInstance:      "Compute Engine",
+	stackdriver.ResourceCloudSQLDatabase: "Cloud SQL",
+	stackdriver.ResourceK8sContainer:     "GKE Cluster",
+	stackdriver.ResourceK8sNode:          "GKE Cluster",
+}
+
+// Resources other than GCE instances go to a sub folder, GKE has one per cluster
+func resourceFolder(basePath, resource, resourceName string) string {
+	switch resource {
+	case stackdriver.ResourceCloudSQLDatabase:
+		return fmt.Sprintf("%s/%s", basePath, cloudSQLFolder)
+	case stackdriver.ResourceK8sContainer, stackdriver.ResourceK8sNode:
+		return fmt.Sprintf("%s/%s/%s", basePath, gkeFolder, resourceName)
+	}
+
+	return basePath
+}
+
+// subjectSeries are the series of one chart
+type subjectSeries struct {
+	Folder string
+	Name   string
+	Series []stackdriver.TimeSeriesPoints
+}
+
+// Metrics with FolderBy/NameBy split their series into one chart per label
+// value, e.g. a GKE workload in a namespace folder. Others have one chart.
+func splitSeries(basePath string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints) []subjectSeries {
+	folder := resourceFolder(basePath, metric.Resource, instanceName)
+
+	if metric.FolderBy == "" && metric.NameBy == "" {
+		return []subjectSeries{{Folder: folder, Name: instanceName, Series: series}}
+	}
+
+	var subjects []subjectSeries
+	subjectIdx := make(map[string]int)
+
+	for _, s := range series {
+		subject := subjectSeries{Folder: folder, Name: instanceName}
+		if metric.FolderBy != "" {
+			subject.Folder = fmt.Sprintf("%s/%s", folder, labelFileName(s.Labels[metric.FolderBy]))
+		}
+		if metric.NameBy != "" {
+			subject.Name = labelFileName(s.Labels[metric.NameBy])
+		}
+
+		key := subject.Folder + "/" + subject.Name
+		idx, ok := subjectIdx[key]
+		if !ok {
+			idx = len(subjects)
+			subjectIdx[key] = idx
+			subjects = append(subjects, subject)
+		}
+		subjects[idx].Series = append(subjects[idx].Series, s)
+	}
+
+	// The series name told apart series of the whole response
+	for i := range subjects {
+		if len(subjects[i].Series) == 1 {
+			subjects[i].Series[0].Name = ""
+		}
+	}
+
+	return subjects
+}
+
+func labelFileName(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+
+	return regexp.MustCompile(`[^\w-]+`).ReplaceAllString(value, "-")
+}
+
+// A filter matching several series gets one file per series, e.g. [asia-east1-a]
+func seriesSuffix(series stackdriver.TimeSeriesPoints) string {
+	if series.Name == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("[%s]", series.Name)
 }
 
 /************************************************
 
-Monthly Report(CSV)
+Report Stuff(CSV)
 
 ************************************************/
 
+//
+// Files are prefixed by the label of the period, e.g. a weekly period:
 //
 // <destination>/
 // └── <project_id>
 //     └── 2018
-//         └── monthly
-//             └── 2018-10
-//                 ├── 2018-10[instance_name][cpu_usage_time].csv
-//  							 └── 2018-10[instance_name][memory_bytes_used].csv
+//         └── weekly
+//             └── 2018-1028-1104
+//                 ├── 2018-1028-1104[instance_name][cpu_usage_time].csv
+//                 ├── 2018-1028-1104[instance_name][memory_bytes_used].csv
+//                 ├── cloudsql
+//                 │   └── 2018-1028-1104[database_name][cloudsql_cpu_utilization].csv
+//                 └── gke
+//                     └── <cluster_name>
+//                         ├── 2018-1028-1104[cluster_name][gke_node_cpu_allocatable_cores].csv
+//                         └── <namespace>
+//                             └── 2018-1028-1104[workload][gke_container_cpu_core_usage_time].csv
 //
-func (g *GCSExporter) ExportMonthlyMetrics(startDate time.Time, projectID, metric, instanceName string, metricPoints []string) {
-	monthStr := fmt.Sprintf("%d-%02d", startDate.Year(), startDate.Month())
-	folder := fmt.Sprintf("%s/%d/monthly/%s", projectID, startDate.Year(), monthStr)
+// The other ranges are laid out the same way under their own folder:
+//
+//   2018/daily/2018-10-28/2018-10-28[...][...].csv
+//   2018/monthly/2018-10/2018-10[...][...].csv
+//   2018/quarterly/2018-Q4/2018-Q4[...][...].csv
+//   2018/yearly/2018/2018[...][...].csv
+//
+func (g *GCSExporter) ExportMetrics(p period.Period, projectID string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints) {
+	g.exportMetricsTo(basePathOfReportStuff(projectID, p), p, metric, instanceName, series)
+}
 
-	title := strings.Replace(metric, "compute.googleapis.com/instance/", "", -1)
-	title = strings.Replace(title, "agent.googleapis.com/", "", -1)
-	title = strings.Replace(title, "/", "_", -1)
+func (g *GCSExporter) exportMetricsTo(basePath string, p period.Period, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints) {
+	title := metric.Name
 
-	output := fmt.Sprintf("%s/%s[%s][%s].csv", folder, monthStr, instanceName, title)
+	for _, subject := range splitSeries(basePath, metric, instanceName, series) {
+		for i := range subject.Series {
+			output := fmt.Sprintf("%s/%s[%s][%s]%s.csv", subject.Folder, p.Label(), subject.Name, title, seriesSuffix(subject.Series[i]))
 
-	g.saveTimeSeriesToCSV(output, metricPoints)
+			g.saveTimeSeriesToCSV(output, subject.Series[i].CSVHeader(), subject.Series[i].MetricPoints)
+		}
+	}
 }
 
 /************************************************
@@ -132,123 +363,123 @@ Report Helper(PNG)
 
 func (g *GCSExporter) saveTimeSeriesToPNG(filename string, graph chart.Chart) {
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
-	}
-
-	bh := client.Bucket(g.BucketName)
-	obj := bh.Object(filename)
-	w := obj.NewWriter(ctx)
+	w := g.bucket(ctx).Object(filename).NewWriter(ctx)
 
 	defer w.Close()
 
-	err = graph.Render(chart.PNG, w)
+	err := graph.Render(chart.PNG, w)
 	if err != nil {
 		log.Fatalf("Failed to export metrics grpah(%s): %v", filename, err)
 	}
 }
 
-/************************************************
-
-Weekly Report(PNG)
+// One line per series, only a single series is filled. A series with min and
+// max values gets a shaded band under its line instead.
+func timeSeriesToChartSeries(series []stackdriver.TimeSeriesPoints) []chart.Series {
+	var bands, lines []chart.Series
 
-************************************************/
+	for i := range series {
+		color := seriesColor(i, len(series))
+		style := chart.Style{
+			Show:        true,
+			StrokeColor: color,
+		}
 
-func (g *GCSExporter) ExportWeeklyMetricsChart(startDate time.Time, projectID, metric, instanceName string, xValues []time.Time, yValues []float64, totalHour int) {
-	graph := chart.Chart{
-		Background: chart.Style{
-			Padding: chart.Box{
-				Top:    10,
-				Left:   10,
-				Right:  50,
-				Bottom: 10,
-			},
-		},
-		Width: 1096,
-		XAxis: chart.XAxis{
-			Name:      "DateTime (1 hour interval)",
-			NameStyle: chart.StyleShow(),
-			Style:     chart.StyleShow(),
-			GridMajorStyle: chart.Style{
-				Show:        true,
-				StrokeColor: chart.ColorAlternateGray,
-				StrokeWidth: 1.0,
-			},
-			GridMinorStyle: chart.Style{
-				Show:        true,
-				StrokeColor: chart.ColorAlternateGray,
-				StrokeWidth: 1.0,
-			},
-			Ticks: generateWeeklyTicks(xValues, totalHour),
-		},
-		YAxis: chart.YAxis{
-			Name:      "Value",
-			NameStyle: chart.StyleShow(),
-			Style: chart.Style{
-				Show:                true,
-				FontSize:            8.0,
-				Font:                utils.GetFont(),
-				TextHorizontalAlign: chart.TextHorizontalAlignRight,
-			},
-			ValueFormatter: getValueFormat(metric),
-			GridMajorStyle: chart.Style{
-				Show:            true,
-				StrokeColor:     chart.ColorAlternateGray,
-				StrokeDashArray: []float64{5.0, 5.0},
-				StrokeWidth:     1.0,
-			},
-		},
-		Series: []chart.Series{
-			chart.TimeSeries{
-				XValues: xValues,
-				YValues: yValues,
+		minValues, hasMin := series[i].ExtraValues["min"]
+		maxValues, hasMax := series[i].ExtraValues["max"]
+		if hasMin && hasMax {
+			bands = append(bands, bandSeries{
+				Name:    seriesBandName(series[i].Name),
+				XValues: series[i].XValues,
+				Y1s:     maxValues,
+				Y2s:     minValues,
 				Style: chart.Style{
 					Show:        true,
-					StrokeColor: drawing.ColorBlue,
-					FillColor:   drawing.ColorBlue.WithAlpha(64),
+					StrokeColor: color.WithAlpha(64),
+					FillColor:   color.WithAlpha(48),
 				},
-			},
-		},
+			})
+		} else if len(series) == 1 {
+			style.FillColor = color.WithAlpha(64)
+		}
+
+		lines = append(lines, chart.TimeSeries{
+			Name:    series[i].Name,
+			XValues: series[i].XValues,
+			YValues: series[i].YValues,
+			Style:   style,
+		})
 	}
 
-	endDate := startDate.AddDate(0, 0, 7)
-	weekStr := fmt.Sprintf("%d-%02d%02d-%02d%02d", startDate.Year(), startDate.Month(), startDate.Day(), endDate.Month(), endDate.Day())
-	folder := fmt.Sprintf("%s/%d/weekly/%s", projectID, startDate.Year(), weekStr)
+	// Bands go under the lines
+	return append(bands, lines...)
+}
+
+// Blue for a single series
+func seriesColor(i, count int) drawing.Color {
+	if count > 1 {
+		return chart.GetDefaultColor(i)
+	}
 
-	title := strings.Replace(metric, "compute.googleapis.com/instance/", "", -1)
-	title = strings.Replace(title, "agent.googleapis.com/", "", -1)
-	title = strings.Replace(title, "/", "_", -1)
+	return drawing.ColorBlue
+}
 
-	output := fmt.Sprintf("%s/%s-%s[%s][%s].png", folder, startDate.Format("2006-0102"), endDate.Format("0102"), instanceName, title)
+func seriesBandName(name string) string {
+	if name == "" {
+		return "min-max"
+	}
 
-	g.saveTimeSeriesToPNG(output, graph)
+	return name + " min-max"
 }
 
-func generateWeeklyTicks(xValues []time.Time, totalHour int) chart.Ticks {
-	ticks := make([]chart.Tick, 0)
-	ticks = append(ticks, chart.Tick{
-		Value: float64(xValues[0].UnixNano()),
-		Label: xValues[0].Format(chart.DefaultDateFormat),
-	})
-	for i := 23; i < totalHour; i += 24 {
-		ticks = append(ticks, chart.Tick{
-			Value: util.Time.ToFloat64((xValues[i])),
-			Label: xValues[i].Format(chart.DefaultDateFormat),
-		})
+// A dashed line at the warning level of the metric
+func warningLevelSeries(metric utils.MetricConf, series []stackdriver.TimeSeriesPoints) []chart.Series {
+	if metric.WarningLevel <= 0 {
+		return nil
+	}
+
+	xValues := series[0].XValues
+	yValues := make([]float64, len(xValues))
+	for i := range yValues {
+		yValues[i] = metric.WarningLevel
+	}
+
+	return []chart.Series{
+		chart.TimeSeries{
+			Name:    "warning level",
+			XValues: xValues,
+			YValues: yValues,
+			Style: chart.Style{
+				Show:            true,
+				StrokeColor:     drawing.ColorRed,
+				StrokeDashArray: []float64{5.0, 5.0},
+			},
+		},
 	}
-	return ticks
 }
 
 /************************************************
 
-Month Report(PNG)
+Report Stuff(PNG)
 
 ************************************************/
 
-func (g *GCSExporter) ExportMonthlyMetricsChart(startDate time.Time, projectID, metric, instanceName string, xValues []time.Time, yValues []float64, totalHour int) {
+func (g *GCSExporter) ExportMetricsChart(p period.Period, projectID string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints) {
+	basePath := basePathOfReportStuff(projectID, p)
+
+	capacity, hasCapacity := g.chartCapacity(p, basePath, metric, instanceName)
+
+	for _, subject := range splitSeries(basePath, metric, instanceName, series) {
+		g.exportMetricsChart(p, subject.Folder, metric, subject.Name, subject.Series, capacity, hasCapacity)
+	}
+}
+
+func (g *GCSExporter) exportMetricsChart(p period.Period, folder string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints, capacity float64, hasCapacity bool) {
+	forecasts, projectedX := g.forecastSeries(p, metric, series, capacity, hasCapacity)
 
 	graph := chart.Chart{
+		Title:      metric.Title,
+		TitleStyle: chart.StyleShow(),
 		Background: chart.Style{
 			Padding: chart.Box{
 				Top:    10,
@@ -259,7 +490,7 @@ func (g *GCSExporter) ExportMonthlyMetricsChart(startDate time.Time, projectID,
 		},
 		Width: 1096,
 		XAxis: chart.XAxis{
-			Name:      "DateTime (1 hour interval)",
+			Name:      xAxisName(series[0].XValues),
 			NameStyle: chart.StyleShow(),
 			Style:     chart.StyleShow(),
 			GridMajorStyle: chart.Style{
@@ -272,7 +503,7 @@ func (g *GCSExporter) ExportMonthlyMetricsChart(startDate time.Time, projectID,
 				StrokeColor: chart.ColorAlternateGray,
 				StrokeWidth: 1.0,
 			},
-			Ticks: generateMonthlyTicks(xValues, totalHour),
+			Ticks: generateTicks(p, append(append([]time.Time(nil), series[0].XValues...), projectedX...)),
 		},
 		YAxis: chart.YAxis{
 			Name:      "Value",
@@ -283,7 +514,7 @@ func (g *GCSExporter) ExportMonthlyMetricsChart(startDate time.Time, projectID,
 				Font:                utils.GetFont(),
 				TextHorizontalAlign: chart.TextHorizontalAlignRight,
 			},
-			ValueFormatter: getValueFormat(metric),
+			ValueFormatter: chart.ValueFormatter(utils.GetValueFormatter(metric.Unit)),
 			GridMajorStyle: chart.Style{
 				Show:            true,
 				StrokeColor:     chart.ColorAlternateGray,
@@ -291,42 +522,108 @@ func (g *GCSExporter) ExportMonthlyMetricsChart(startDate time.Time, projectID,
 				StrokeWidth:     1.0,
 			},
 		},
-		Series: []chart.Series{
-			chart.TimeSeries{
-				XValues: xValues,
-				YValues: yValues,
-				Style: chart.Style{
-					Show:        true,
-					StrokeColor: drawing.ColorBlue,
-					FillColor:   drawing.ColorBlue.WithAlpha(64),
-				},
-			},
-		},
+		Series: append(append(append(timeSeriesToChartSeries(series), warningLevelSeries(metric, series)...), g.anomalySeries(series)...), forecasts...),
+	}
+	if len(series) > 1 {
+		graph.Elements = []chart.Renderable{chart.Legend(&graph)}
 	}
 
-	monthStr := fmt.Sprintf("%d-%02d", startDate.Year(), startDate.Month())
-	folder := fmt.Sprintf("%s/%d/monthly/%s", projectID, startDate.Year(), monthStr)
-
-	title := strings.Replace(metric, "compute.googleapis.com/instance/", "", -1)
-	title = strings.Replace(title, "agent.googleapis.com/", "", -1)
-	title = strings.Replace(title, "/", "_", -1)
+	title := metric.Name
 
-	output := fmt.Sprintf("%s/%s[%s][%s].png", folder, monthStr, instanceName, title)
+	output := fmt.Sprintf("%s/%s[%s][%s].png", folder, p.Label(), instanceName, title)
 
 	g.saveTimeSeriesToPNG(output, graph)
 }
 
-func generateMonthlyTicks(xValues []time.Time, totalHour int) chart.Ticks {
+// e.g. DateTime (1 hour interval)
+func xAxisName(xValues []time.Time) string {
+	if len(xValues) < 2 {
+		return "DateTime"
+	}
+
+	step := xValues[1].Sub(xValues[0])
+	switch {
+	case step == time.Hour:
+		return "DateTime (1 hour interval)"
+	case step%time.Hour == 0:
+		return fmt.Sprintf("DateTime (%d hours interval)", step/time.Hour)
+	case step == time.Minute:
+		return "DateTime (1 minute interval)"
+	default:
+		return fmt.Sprintf("DateTime (%d minutes interval)", step/time.Minute)
+	}
+}
+
+// Ticks of the range: every 3 hours of a day, every midnight of a week or a
+// month, the 1st and the 15th of a quarter's months and every month of a year
+func generateTicks(p period.Period, xValues []time.Time) chart.Ticks {
+	switch p.Range {
+	case period.Daily:
+		return generateTicksAt(xValues, "15:04", func(t time.Time) bool {
+			return t.Minute() == 0 && t.Hour()%3 == 0
+		})
+	case period.Monthly:
+		return generateTicksAt(xValues, "02", isMidnight)
+	case period.Quarterly:
+		return generateDateTicks(xValues, "01/02", func(t time.Time) time.Time {
+			if t.Day() < 15 {
+				return time.Date(t.Year(), t.Month(), 15, 0, 0, 0, 0, t.Location())
+			}
+			return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		})
+	case period.Yearly:
+		return generateDateTicks(xValues, "Jan", func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		})
+	}
+
+	return generateTicksAt(xValues, chart.DefaultDateFormat, isMidnight)
+}
+
+func isMidnight(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0
+}
+
+// A tick at the first point and at every point isTick accepts, whatever the
+// alignment period
+func generateTicksAt(xValues []time.Time, layout string, isTick func(time.Time) bool) chart.Ticks {
 	ticks := make([]chart.Tick, 0)
+	if len(xValues) == 0 {
+		return ticks
+	}
+
 	ticks = append(ticks, chart.Tick{
 		Value: float64(xValues[0].UnixNano()),
-		Label: xValues[0].Format("02"),
+		Label: xValues[0].Format(layout),
 	})
-	for i := 23; i < totalHour; i += 24 {
+	for i := 1; i < len(xValues); i++ {
+		if !isTick(xValues[i]) {
+			continue
+		}
 		ticks = append(ticks, chart.Tick{
 			Value: util.Time.ToFloat64((xValues[i])),
-			Label: xValues[i].Format("02"),
+			Label: xValues[i].Format(layout),
+		})
+	}
+	return ticks
+}
+
+// A tick at the first point and at the first point on or after every local
+// date next returns after a tick. Steps of 6 hours or a day drift off
+// midnight after a DST change, the dates do not.
+func generateDateTicks(xValues []time.Time, layout string, next func(time.Time) time.Time) chart.Ticks {
+	ticks := make([]chart.Tick, 0)
+
+	var date time.Time
+	for i, x := range xValues {
+		if i > 0 && x.Before(date) {
+			continue
+		}
+		ticks = append(ticks, chart.Tick{
+			Value: util.Time.ToFloat64(x),
+			Label: x.Format(layout),
 		})
+		date = next(x)
 	}
 	return ticks
 }
@@ -337,10 +634,8 @@ Report Helper(PDF)
 
 ************************************************/
 
-type GraphReaders struct {
-	cpuReader *ImageReader
-	memReader *ImageReader
-}
+// Chart images of one instance keyed by metric name
+type GraphReaders map[string]*ImageReader
 
 type ImageReader struct {
 	Path   string
@@ -362,9 +657,41 @@ func (ir ImageReader) ImageMetricType() string {
 	return r.FindAllString(ir.Path, -1)[1]
 }
 
-func (g *GCSExporter) GetImageReaderMaps(ctx context.Context, bh *storage.BucketHandle, basePath string) ([]string, map[string]*GraphReaders) {
+// State on the cover how much data the instance discovery, the exports and
+// the comparisons read
+func writeListStats(pdf *gofpdf.Fpdf, listStats []stackdriver.ListStats) {
+	if len(listStats) == 0 {
+		return
+	}
+
+	for _, stats := range listStats {
+		if stats.Source == stackdriver.ListSourceDiscovery {
+			pdf.SetFont("Times", "", 12)
+			pdf.CellFormat(0, 8, fmt.Sprintf("%s: %d time series in %d page(s)", stats.Metric, stats.TimeSeries, stats.Pages), "", 1, "C", false, 0, "")
+			continue
+		}
+
+		pdf.SetFont("Times", "", 10)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%s %s: %d time series in %d page(s)", stats.Metric, stats.Source, stats.TimeSeries, stats.Pages), "", 1, "C", false, 0, "")
+	}
+}
+
+// State on the cover which instances the report leaves out
+func writeSelectionRules(pdf *gofpdf.Fpdf, selections utils.Selections, projectID string) {
+	selection, ok := selections.Of(projectID)
+	if !ok {
+		return
+	}
+
+	pdf.SetFont("Times", "", 12)
+	for _, rule := range selection.Rules() {
+		pdf.CellFormat(0, 8, rule, "", 1, "C", false, 0, "")
+	}
+}
+
+func (g *GCSExporter) GetImageReaderMaps(ctx context.Context, bh *storage.BucketHandle, basePath string) ([]string, map[string]GraphReaders) {
 	var keys []string
-	imageReaderMaps := make(map[string]*GraphReaders)
+	imageReaderMaps := make(map[string]GraphReaders)
 
 	q := &storage.Query{Prefix: fmt.Sprintf("%s/", basePath), Delimiter: "/"}
 	it := bh.Objects(ctx, q)
@@ -392,20 +719,14 @@ func (g *GCSExporter) GetImageReaderMaps(ctx context.Context, bh *storage.Bucket
 			}
 
 			instanceName := imageReader.ImageInstanceName()
-			metricType := imageReader.ImageMetricType()
+			metricName := strings.Trim(imageReader.ImageMetricType(), "[]")
 
 			imageReaderMap, ok := imageReaderMaps[instanceName]
 			if !ok {
-				imageReaderMap = &GraphReaders{}
+				imageReaderMap = GraphReaders{}
 				keys = append(keys, instanceName)
 			}
-			// cpu
-			if "[cpu_usage_time]" == metricType {
-				imageReaderMap.cpuReader = &imageReader
-				// mem
-			} else {
-				imageReaderMap.memReader = &imageReader
-			}
+			imageReaderMap[metricName] = &imageReader
 			imageReaderMaps[instanceName] = imageReaderMap
 		}
 	}
@@ -414,120 +735,363 @@ func (g *GCSExporter) GetImageReaderMaps(ctx context.Context, bh *storage.Bucket
 	return keys, imageReaderMaps
 }
 
-/************************************************
+func writeWarnings(pdf *gofpdf.Fpdf, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
 
-Weekly Report(PDF)
+	pdf.SetFont("Times", "", 12)
+	pdf.SetTextColor(200, 0, 0)
+	for _, warning := range warnings {
+		pdf.CellFormat(0, 6, warning, "", 1, "C", false, 0, "")
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Times", "B", 16)
+}
 
-************************************************/
+type metricGroup struct {
+	Name    string
+	Metrics []utils.MetricConf
+}
 
-func (g *GCSExporter) ExportWeeklyReport(projectID string, startDate time.Time) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+// Groups in the order they first appear in the catalog
+func metricGroups(metrics []utils.MetricConf) []metricGroup {
+	var groups []metricGroup
+	groupIdx := make(map[string]int)
+
+	for _, metric := range metrics {
+		idx, ok := groupIdx[metric.Group]
+		if !ok {
+			idx = len(groups)
+			groupIdx[metric.Group] = idx
+			groups = append(groups, metricGroup{Name: metric.Group})
+		}
+		groups[idx].Metrics = append(groups[idx].Metrics, metric)
 	}
 
-	bh := client.Bucket(g.BucketName)
+	return groups
+}
 
-	basePath := basePathOfWeeklyReportStuff(projectID, "weekly", startDate)
-	log.Printf("basePath: %s", basePath)
+// Warning messages of each instance keyed by metric name, for the series whose
+// trend at the end of the period is above the warning level of the metric.
+func levelWarnings(metrics []utils.MetricConf, seriesMaps map[string]map[string][]SeriesValues) map[string]map[string][]string {
+	warnings := make(map[string]map[string][]string)
 
-	keys, imageReaderMaps := g.GetImageReaderMaps(ctx, bh, basePath)
+	for instanceName, seriesMap := range seriesMaps {
+		for _, metric := range metrics {
+			if metric.WarningLevel <= 0 {
+				continue
+			}
 
-	// Generate report
-	pdf := gofpdf.New("P", "mm", "A4", "")
+			for _, series := range seriesMap[metric.Name] {
+				trend, ok := analysis.LinearTrend(series.XValues, series.YValues)
+				if !ok {
+					continue
+				}
+
+				last := series.XValues[len(series.XValues)-1]
+				value := trend.At(last)
+				if value <= metric.WarningLevel {
+					continue
+				}
+
+				name := series.Name
+				if name == "" {
+					name = metric.Title
+				}
+
+				if _, ok := warnings[instanceName]; !ok {
+					warnings[instanceName] = make(map[string][]string)
+				}
+				warnings[instanceName][metric.Name] = append(warnings[instanceName][metric.Name],
+					fmt.Sprintf("Warning: %s trends to %s at %s, above %s", name, utils.GetValueFormatter(metric.Unit)(value), last.Format("2006/01/02 15:04"), utils.GetValueFormatter(metric.Unit)(metric.WarningLevel)))
+			}
+		}
+	}
 
-	// Cover
-	pdf.AddPage()
-	pdf.SetFont("Times", "B", 24)
-	pdf.CellFormat(0, 50, weeklyReportTitle(projectID, "weekly", startDate), "", 1, "C", false, 0, "")
+	return warnings
+}
 
-	// Pages
-	pdf.SetFont("Times", "B", 16)
+// reportSection holds the charts of one folder. Names are the display names
+// of keys which are not readable, e.g. GCE instance IDs. Series are the ones
+// read back from the CSVs.
+type reportSection struct {
+	Title           string
+	Keys            []string
+	Names           map[string]string
+	ImageReaderMaps map[string]GraphReaders
+	Series          map[string]map[string][]SeriesValues
+	Warnings        map[string]map[string][]string
+	Summaries       map[string]map[string][]seriesSummary
+	Deltas          map[string]map[string][]seriesDelta
+	Anomalies       map[string]map[string][]seriesAnomaly
+	Forecasts       map[string]map[string][]seriesForecast
+	Heatmaps        map[string]map[string]*analysis.Heatmap
+	FleetHeatmaps   map[string]*fleetHeatmap
+}
 
-	readersLen := len(imageReaderMaps)
+func (s reportSection) imageTitle(key string, imageReader *ImageReader) string {
+	name, ok := s.Names[key]
+	if !ok {
+		return imageReader.ImageTitle()
+	}
 
-	// No output
-	if readersLen == 0 {
-		g.ReportName = ""
-		g.ReportPath = ""
-		return
+	return fmt.Sprintf("[%s]%s", name, imageReader.ImageMetricType())
+}
+
+// reportChapter holds the charts of one resource type, or one GKE cluster
+type reportChapter struct {
+	Title    string
+	Resource string
+	Metrics  []utils.MetricConf
+	Sections []reportSection
+}
+
+// One chapter for each resource type of the catalog that has charts, GKE
+// has one chapter per cluster and one section per namespace. Priors are the
+// base paths of the periods the charts are compared with.
+func (g *GCSExporter) loadChapters(ctx context.Context, bh *storage.BucketHandle, p period.Period, basePath string, priors []priorFolder) []reportChapter {
+	var chapters []reportChapter
+
+	var resources []string
+	resourceMetrics := make(map[string][]utils.MetricConf)
+	for _, metric := range g.Metrics {
+		resource := metric.Resource
+		// Container and node metrics share the cluster chapter
+		if resource == stackdriver.ResourceK8sNode {
+			resource = stackdriver.ResourceK8sContainer
+		}
+
+		if _, ok := resourceMetrics[resource]; !ok {
+			resources = append(resources, resource)
+		}
+		resourceMetrics[resource] = append(resourceMetrics[resource], metric)
 	}
 
-	for _, key := range keys {
-		pdf.AddPage()
+	for _, resource := range resources {
+		metrics := resourceMetrics[resource]
+
+		if resource != stackdriver.ResourceK8sContainer {
+			var inventory []gcp.Instance
+			if resource == stackdriver.ResourceGCEInstance {
+				inventory = g.loadInventory(ctx, bh, basePath)
+			}
+
+			folder := resourceFolder(basePath, resource, "")
+			section := g.loadSection(ctx, bh, metrics, folder, "", inventory, priorFoldersOf(basePath, folder, priors), p)
+			if len(section.ImageReaderMaps) == 0 {
+				continue
+			}
+
+			chapters = append(chapters, reportChapter{
+				Title:    resourceTitles[resource],
+				Resource: resource,
+				Metrics:  metrics,
+				Sections: []reportSection{section},
+			})
+			continue
+		}
+
+		for _, clusterFolder := range listFolders(ctx, bh, fmt.Sprintf("%s/%s", basePath, gkeFolder)) {
+			chapter := reportChapter{
+				Title:    fmt.Sprintf("%s %s", resourceTitles[resource], path.Base(clusterFolder)),
+				Resource: resource,
+				Metrics:  metrics,
+			}
 
-		imageReaderMap := imageReaderMaps[key]
-		cpuReader := imageReaderMap.cpuReader
+			section := g.loadSection(ctx, bh, metrics, clusterFolder, "", nil, priorFoldersOf(basePath, clusterFolder, priors), p)
+			if len(section.ImageReaderMaps) > 0 {
+				chapter.Sections = append(chapter.Sections, section)
+			}
 
-		defer cpuReader.Reader.Close()
-		_ = pdf.RegisterImageOptionsReader(cpuReader.Path, gofpdf.ImageOptions{ImageType: "png", ReadDpi: true}, cpuReader.Reader)
-		pdf.CellFormat(0, 50, cpuReader.ImageTitle(), "", 1, "C", false, 0, "")
-		pdf.Image(cpuReader.Path, 0, 0, -128, 0, true, "png", 0, "")
+			for _, namespaceFolder := range listFolders(ctx, bh, clusterFolder) {
+				section := g.loadSection(ctx, bh, metrics, namespaceFolder, fmt.Sprintf("Namespace %s", path.Base(namespaceFolder)), nil, priorFoldersOf(basePath, namespaceFolder, priors), p)
+				if len(section.ImageReaderMaps) > 0 {
+					chapter.Sections = append(chapter.Sections, section)
+				}
+			}
 
-		memReader := imageReaderMap.memReader
-		if memReader != nil {
-			defer memReader.Reader.Close()
-			_ = pdf.RegisterImageOptionsReader(memReader.Path, gofpdf.ImageOptions{ImageType: "png", ReadDpi: true}, memReader.Reader)
-			pdf.CellFormat(0, 50, memReader.ImageTitle(), "", 1, "C", false, 0, "")
-			pdf.Image(memReader.Path, 0, 0, -128, 0, true, "png", 0, "")
+			if len(chapter.Sections) > 0 {
+				chapters = append(chapters, chapter)
+			}
 		}
 	}
 
-	// Upload report
-	g.ReportName = weeklyReportName(projectID, "weekly", startDate)
-	g.ReportPath = fmt.Sprintf("%s/%s", basePath, g.ReportName)
-	obj := bh.Object(g.ReportPath)
-	w := obj.NewWriter(ctx)
+	return chapters
+}
 
-	defer w.Close()
+// Keys with a display name in the inventory are sorted by it. The features
+// enabled for the range of the period are computed.
+func (g *GCSExporter) loadSection(ctx context.Context, bh *storage.BucketHandle, metrics []utils.MetricConf, folder, title string, inventory []gcp.Instance, priors []priorFolder, p period.Period) reportSection {
+	keys, imageReaderMaps := g.GetImageReaderMaps(ctx, bh, folder)
+	names := instanceNames(inventory)
 
-	err = pdf.Output(w)
-	if err != nil {
-		log.Fatalf("Failed to export weekly report: %v", err)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return displayName(keys[i], names) < displayName(keys[j], names)
+	})
+
+	seriesMaps := g.loadSectionSeries(ctx, bh, metrics, g.getCSVPathMaps(ctx, bh, folder))
+	summaries := summarizeSeries(seriesMaps)
+
+	var forecasts map[string]map[string][]seriesForecast
+	if g.Forecast.Enabled(p.Range) {
+		forecasts = g.projectSeries(metrics, seriesMaps, instanceMemories(inventory))
+	}
+
+	var heatmaps map[string]map[string]*analysis.Heatmap
+	var fleet map[string]*fleetHeatmap
+	if g.Heatmaps.Enabled(p.Range) {
+		heatmaps, fleet = g.buildHeatmaps(metrics, seriesMaps, p.Calendar.WeekStart)
+	}
+
+	return reportSection{
+		Title:           title,
+		Keys:            keys,
+		Names:           names,
+		ImageReaderMaps: imageReaderMaps,
+		Series:          seriesMaps,
+		Warnings:        levelWarnings(metrics, seriesMaps),
+		Summaries:       summaries,
+		Deltas:          g.compareSeries(ctx, bh, metrics, summaries, priors),
+		Anomalies:       g.detectAnomalies(seriesMaps),
+		Forecasts:       forecasts,
+		Heatmaps:        heatmaps,
+		FleetHeatmaps:   fleet,
 	}
 }
 
-func basePathOfWeeklyReportStuff(projectID, reportType string, startDate time.Time) string {
-	endDate := startDate.AddDate(0, 0, 7)
-	durationStr := fmt.Sprintf("%d-%02d%02d-%02d%02d", startDate.Year(), startDate.Month(), startDate.Day(), endDate.Month(), endDate.Day())
-	folder := fmt.Sprintf("%s/%d/%s/%s", projectID, startDate.Year(), reportType, durationStr)
+func displayName(key string, names map[string]string) string {
+	if name, ok := names[key]; ok {
+		return name
+	}
 
-	return folder
+	return strings.Trim(key, "[]")
 }
 
-func weeklyReportTitle(projectID, reportType string, startDate time.Time) string {
-	endDate := startDate.AddDate(0, 0, 7)
-	title := fmt.Sprintf("Metrics Weekly Report %s - %s", startDate.Format("2006/01/02"), endDate.Format("2006/01/02"))
+// Sub folders right under a folder, without the trailing slash
+func listFolders(ctx context.Context, bh *storage.BucketHandle, folder string) (folders []string) {
+	q := &storage.Query{Prefix: fmt.Sprintf("%s/", folder), Delimiter: "/"}
+	it := bh.Objects(ctx, q)
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Failed to list folders: %v", err)
+		}
+
+		if objAttrs.Prefix != "" {
+			folders = append(folders, strings.TrimSuffix(objAttrs.Prefix, "/"))
+		}
+	}
 
-	return title
+	sort.Strings(folders)
+	return
 }
 
-func weeklyReportName(projectID, reportType string, startDate time.Time) string {
-	endDate := startDate.AddDate(0, 0, 7)
-	durationStr := fmt.Sprintf("%d-%02d%02d-%02d%02d", startDate.Year(), startDate.Month(), startDate.Day(), endDate.Month(), endDate.Day())
-	return fmt.Sprintf("%s-%s-report-%s.pdf", durationStr, reportType, projectID)
+// A title page starts each chapter when there are several
+// Links point to the first page of GCE instances, details limits the GCE
+// instances with pages when it is not nil.
+func (g *GCSExporter) writeChapters(pdf *gofpdf.Fpdf, chapters []reportChapter, links map[string]int, details map[string]bool) {
+	for _, chapter := range chapters {
+		if len(chapters) > 1 {
+			pdf.AddPage()
+			pdf.SetFont("Times", "B", 24)
+			pdf.CellFormat(0, 50, chapter.Title, "", 1, "C", false, 0, "")
+			pdf.SetFont("Times", "B", 16)
+		}
+
+		chapterDetails := details
+		if chapter.Resource != stackdriver.ResourceGCEInstance {
+			chapterDetails = nil
+		}
+
+		for _, section := range chapter.Sections {
+			g.writeInstancePages(pdf, chapter.Metrics, section, links, chapterDetails)
+		}
+	}
+}
+
+// Every metric group of an instance starts a new page, two charts per page,
+// each one with the statistics table of its series and their change versus
+// earlier periods, then the heatmaps of the instance. The section title goes
+// on top of its first page.
+func (g *GCSExporter) writeInstancePages(pdf *gofpdf.Fpdf, metrics []utils.MetricConf, section reportSection, links map[string]int, details map[string]bool) {
+	groups := metricGroups(metrics)
+	sectionTitle := section.Title
+
+	for _, key := range section.Keys {
+		imageReaderMap := section.ImageReaderMaps[key]
+		if details != nil && !details[key] {
+			for _, imageReader := range imageReaderMap {
+				imageReader.Reader.Close()
+			}
+			continue
+		}
+		link, linked := links[key]
+
+		for _, group := range groups {
+			count := 0
+			for _, metric := range group.Metrics {
+				imageReader, ok := imageReaderMap[metric.Name]
+				if !ok {
+					continue
+				}
+
+				if count%2 == 0 {
+					pdf.AddPage()
+					if linked {
+						pdf.SetLink(link, 0, -1)
+						linked = false
+					}
+
+					if sectionTitle != "" {
+						pdf.SetFont("Times", "B", 20)
+						pdf.CellFormat(0, 10, sectionTitle, "", 1, "L", false, 0, "")
+						pdf.SetFont("Times", "B", 16)
+						sectionTitle = ""
+					}
+				}
+				count++
+
+				_ = pdf.RegisterImageOptionsReader(imageReader.Path, gofpdf.ImageOptions{ImageType: "png", ReadDpi: true}, imageReader.Reader)
+				imageReader.Reader.Close()
+
+				pdf.CellFormat(0, 20, section.imageTitle(key, imageReader), "", 1, "C", false, 0, "")
+				pdf.Image(imageReader.Path, 0, 0, -128, 0, true, "png", 0, "")
+
+				writeStatsTable(pdf, metric, section.Summaries[key][metric.Name])
+				writeComparisons(pdf, metric, section.Deltas[key][metric.Name])
+				writeWarnings(pdf, section.Warnings[key][metric.Name])
+				g.writeForecasts(pdf, metric, section.Forecasts[key][metric.Name])
+			}
+		}
+
+		for _, metric := range metrics {
+			if heatmap, ok := section.Heatmaps[key][metric.Name]; ok {
+				g.writeHeatmap(pdf, fmt.Sprintf("[%s] %s", displayName(key, section.Names), metric.Title), metric, heatmap)
+			}
+		}
+	}
 }
 
 /************************************************
 
-Monthly Report(PDF)
+Report(PDF)
 
 ************************************************/
 
-func (g *GCSExporter) ExportMonthlyReport(projectID string, startDate time.Time) {
+// ComparisonStats are the list stats of the comparison data the report job
+// fetched
+func (g *GCSExporter) ExportReport(projectID string, p period.Period, comparisonStats []stackdriver.ListStats) {
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
-	}
+	bh := g.bucket(ctx)
 
-	bh := client.Bucket(g.BucketName)
-
-	basePath := basePathOfMonthlyReportStuff(projectID, "monthly", startDate)
+	basePath := basePathOfReportStuff(projectID, p)
 	log.Printf("basePath: %s", basePath)
 
-	keys, imageReaderMaps := g.GetImageReaderMaps(ctx, bh, basePath)
+	chapters := g.loadChapters(ctx, bh, p, basePath, priorBasePaths(projectID, p))
 
 	// Generate report
 	pdf := gofpdf.New("P", "mm", "A4", "")
@@ -535,70 +1099,74 @@ func (g *GCSExporter) ExportMonthlyReport(projectID string, startDate time.Time)
 	// Cover
 	pdf.AddPage()
 	pdf.SetFont("Times", "B", 24)
-	pdf.CellFormat(0, 50, monthlyReportTitle(projectID, "monthly", startDate), "", 1, "C", false, 0, "")
+	pdf.CellFormat(0, 50, reportTitle(p), "", 1, "C", false, 0, "")
+	writeListStats(pdf, g.reportListStats(ctx, bh, basePath, comparisonStats))
+	writeSelectionRules(pdf, g.Selections, projectID)
 
 	// Pages
 	pdf.SetFont("Times", "B", 16)
 
-	readersLen := len(imageReaderMaps)
-
 	// No output
-	if readersLen == 0 {
+	if len(chapters) == 0 {
 		g.ReportName = ""
 		g.ReportPath = ""
 		return
 	}
 
-	for _, key := range keys {
-		pdf.AddPage()
-
-		imageReaderMap := imageReaderMaps[key]
-		cpuReader := imageReaderMap.cpuReader
-
-		defer cpuReader.Reader.Close()
-		_ = pdf.RegisterImageOptionsReader(cpuReader.Path, gofpdf.ImageOptions{ImageType: "png", ReadDpi: true}, cpuReader.Reader)
-		pdf.CellFormat(0, 50, cpuReader.ImageTitle(), "", 1, "C", false, 0, "")
-		pdf.Image(cpuReader.Path, 0, 0, -128, 0, true, "png", 0, "")
-
-		memReader := imageReaderMap.memReader
-		if memReader != nil {
-			defer memReader.Reader.Close()
-			_ = pdf.RegisterImageOptionsReader(memReader.Path, gofpdf.ImageOptions{ImageType: "png", ReadDpi: true}, memReader.Reader)
-			pdf.CellFormat(0, 50, memReader.ImageTitle(), "", 1, "C", false, 0, "")
-			pdf.Image(memReader.Path, 0, 0, -128, 0, true, "png", 0, "")
-		}
+	rankings := g.rankInstances(chapters)
+	var details map[string]bool
+	if g.Ranking.TopDetailsOnly && len(rankings) > 0 {
+		details = topKeys(rankings)
 	}
+	links := instanceLinks(pdf, chapters, details)
+
+	g.writeRanking(pdf, rankings, links)
+	g.writeFleetHeatmaps(pdf, chapters)
+	g.writeChapters(pdf, chapters, links, details)
+	inventory := g.loadInventory(ctx, bh, basePath)
+	var recommendations []instanceRecommendation
+	if g.Rightsizing.Enabled(p.Range) {
+		recommendations = g.rightsize(chapters, inventory)
+		writeRightsizing(pdf, recommendations)
+		g.saveRightsizingToCSV(rightsizingPath(basePath), recommendations)
+	}
+	if g.Cost.Enabled(p.Range) {
+		costs := g.estimateCosts(p, chapters, inventory, recommendations)
+		g.writeCosts(pdf, costs)
+		g.saveCostsToCSV(costPath(basePath), costs)
+	}
+	g.writeCapacityForecasts(pdf, reportForecasts(chapters))
+	writeAnomalies(pdf, reportAnomalies(chapters))
+	writeNoDataInstances(pdf, g.noDataInstances(ctx, bh, basePath))
+	g.saveSummaryToCSV(summaryPath(basePath), chapters)
 
 	// Upload report
-	g.ReportName = monthlyReportName(projectID, "monthly", startDate)
+	g.ReportName = reportName(projectID, p)
 	g.ReportPath = fmt.Sprintf("%s/%s", basePath, g.ReportName)
 	obj := bh.Object(g.ReportPath)
 	w := obj.NewWriter(ctx)
 
 	defer w.Close()
 
-	err = pdf.Output(w)
+	err := pdf.Output(w)
 	if err != nil {
-		log.Fatalf("Failed to export monthly report: %v", err)
+		log.Fatalf("Failed to export %s report: %v", p.Range, err)
 	}
 }
 
-func basePathOfMonthlyReportStuff(projectID, reportType string, startDate time.Time) string {
-	durationStr := fmt.Sprintf("%d-%02d", startDate.Year(), startDate.Month())
-	folder := fmt.Sprintf("%s/%d/%s/%s", projectID, startDate.Year(), reportType, durationStr)
-
-	return folder
+// e.g. <project_id>/2018/weekly/2018-1028-1104
+func basePathOfReportStuff(projectID string, p period.Period) string {
+	return fmt.Sprintf("%s/%d/%s/%s", projectID, p.Year(), p.Range, p.Label())
 }
 
-func monthlyReportTitle(projectID, reportType string, startDate time.Time) string {
-	title := fmt.Sprintf("Metrics Monthly Report %s", startDate.Format("2006/01"))
-
-	return title
+// e.g. Metrics Weekly Report 2018/10/28 - 2018/11/04
+func reportTitle(p period.Period) string {
+	return fmt.Sprintf("Metrics %s Report %s", p.Name(), p.Dates())
 }
 
-func monthlyReportName(projectID, reportType string, startDate time.Time) string {
-	durationStr := fmt.Sprintf("%d-%02d", startDate.Year(), startDate.Month())
-	return fmt.Sprintf("%s-%s-report-%s.pdf", durationStr, reportType, projectID)
+// e.g. 2018-1028-1104-weekly-report-<project_id>.pdf
+func reportName(projectID string, p period.Period) string {
+	return fmt.Sprintf("%s-%s-report-%s.pdf", p.Label(), p.Range, projectID)
 }
 
 /************************************************
@@ -633,55 +1201,26 @@ func sendMail(appCtx context.Context, subject string, mailReceiver string, attac
 
 /************************************************
 
-Weekly Report(Mail)
-
-************************************************/
-
-func (g *GCSExporter) SendWeeklyReport(appCtx context.Context, projectID, mailReceiver string, startDate time.Time) {
-	log.Printf("SendWeeklyReport ReportName: %s", g.ReportName)
-	log.Printf("SendWeeklyReport ReportPath: %s", g.ReportPath)
-
-	if g.ReportPath == "" {
-		return
-	}
-
-	subject := weeklyReportSubject(projectID, startDate)
-	attach := g.getAttachment()
-
-	sendMail(appCtx, subject, mailReceiver, attach)
-}
-
-func weeklyReportSubject(projectID string, startDate time.Time) string {
-	endDate := startDate.AddDate(0, 0, 7)
-	title := fmt.Sprintf("Metrics Weekly Report %s - %s: %s", startDate.Format("2006/01/02"), endDate.Format("2006/01/02"), projectID)
-
-	return title
-}
-
-/************************************************
-
-Monthly Report(Mail)
+Report(Mail)
 
 ************************************************/
 
-func (g *GCSExporter) SendMonthlyReport(appCtx context.Context, projectID, mailReceiver string, startDate time.Time) {
-	log.Printf("SendMonthlyReport ReportName: %s", g.ReportName)
-	log.Printf("SendMonthlyReport ReportPath: %s", g.ReportPath)
+func (g *GCSExporter) SendReport(appCtx context.Context, projectID, mailReceiver string, p period.Period) {
+	log.Printf("SendReport ReportName: %s", g.ReportName)
+	log.Printf("SendReport ReportPath: %s", g.ReportPath)
 
 	if g.ReportPath == "" {
 		return
 	}
 
-	subject := monthlyReportSubject(projectID, startDate)
+	subject := reportSubject(projectID, p)
 	attach := g.getAttachment()
 
 	sendMail(appCtx, subject, mailReceiver, attach)
 }
 
-func monthlyReportSubject(projectID string, startDate time.Time) string {
-	title := fmt.Sprintf("Metrics Monthly Report %s: %s", startDate.Format("2006/01"), projectID)
-
-	return title
+func reportSubject(projectID string, p period.Period) string {
+	return fmt.Sprintf("%s: %s", reportTitle(p), projectID)
 }
 
 /************************************************
@@ -692,14 +1231,7 @@ Mail Attachment
 
 func (g *GCSExporter) getAttachment() mail.Attachment {
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
-	}
-
-	bh := client.Bucket(g.BucketName)
-	obj := bh.Object(g.ReportPath)
-	r, err := obj.NewReader(ctx)
+	r, err := g.bucket(ctx).Object(g.ReportPath).NewReader(ctx)
 	if err != nil {
 		log.Fatalf("Couldn't create reader: %v", err)
 	}
@@ -0,0 +1,169 @@
+package metric_exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Heatmaps
+
+************************************************/
+
+// fleetHeatmap pools the series of every instance of a section
+type fleetHeatmap struct {
+	Heatmap   *analysis.Heatmap
+	Instances int
+}
+
+// Heatmaps of each instance keyed by metric name when they get their own
+// pages, and the pooled ones of the section
+func (g *GCSExporter) buildHeatmaps(metrics []utils.MetricConf, seriesMaps map[string]map[string][]SeriesValues, weekStart time.Weekday) (heatmaps map[string]map[string]*analysis.Heatmap, fleet map[string]*fleetHeatmap) {
+	heatmaps = make(map[string]map[string]*analysis.Heatmap)
+	fleet = make(map[string]*fleetHeatmap)
+
+	for instanceName, seriesMap := range seriesMaps {
+		for _, metric := range metrics {
+			seriesList, ok := seriesMap[metric.Name]
+			if !ok || !g.Heatmaps.Of(metric.Name) {
+				continue
+			}
+
+			heatmap := analysis.NewHeatmap(weekStart)
+			for _, series := range seriesList {
+				heatmap.Add(series.XValues, series.YValues)
+			}
+
+			if _, ok := fleet[metric.Name]; !ok {
+				fleet[metric.Name] = &fleetHeatmap{Heatmap: analysis.NewHeatmap(weekStart)}
+			}
+			fleet[metric.Name].Heatmap.Merge(heatmap)
+			fleet[metric.Name].Instances++
+
+			if g.Heatmaps.InstancePages {
+				if _, ok := heatmaps[instanceName]; !ok {
+					heatmaps[instanceName] = make(map[string]*analysis.Heatmap)
+				}
+				heatmaps[instanceName][metric.Name] = heatmap
+			}
+		}
+	}
+
+	return
+}
+
+// Cells go from pale yellow at zero to dark red at the highest mean
+var (
+	heatmapLow    = [3]float64{255, 255, 204}
+	heatmapHigh   = [3]float64{189, 0, 38}
+	heatmapNoData = [3]float64{235, 235, 235}
+)
+
+const (
+	heatmapLabelWidth = 22.0
+	heatmapCellWidth  = 7.0
+	heatmapCellHeight = 10.0
+)
+
+func heatmapColor(value, low, high float64) (r, g, b int) {
+	t := 1.0
+	if high > low {
+		t = (value - low) / (high - low)
+	}
+
+	var c [3]int
+	for i := range c {
+		c[i] = int(heatmapLow[i] + (heatmapHigh[i]-heatmapLow[i])*t)
+	}
+
+	return c[0], c[1], c[2]
+}
+
+// A page with the heatmap, weekdays down and hours across, and the color
+// scale under it
+func (g *GCSExporter) writeHeatmap(pdf *gofpdf.Fpdf, title string, metric utils.MetricConf, heatmap *analysis.Heatmap) {
+	min, max, ok := heatmap.Bounds()
+	if !ok {
+		return
+	}
+	low := 0.0
+	if min < 0 {
+		low = min
+	}
+	formatter := utils.GetValueFormatter(metric.Unit)
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 16)
+	pdf.MultiCell(0, 8, title, "", "C", false)
+	pdf.SetFont("Times", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("Mean %s by weekday and hour (%s)", metric.Title, g.Location), "", 1, "C", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Times", "", 8)
+	pdf.CellFormat(heatmapLabelWidth, 6, "", "", 0, "C", false, 0, "")
+	for hour := 0; hour < 24; hour++ {
+		pdf.CellFormat(heatmapCellWidth, 6, fmt.Sprintf("%d", hour), "", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	for row := 0; row < 7; row++ {
+		pdf.CellFormat(heatmapLabelWidth, heatmapCellHeight, heatmap.Weekday(row).String(), "", 0, "L", false, 0, "")
+		for hour := 0; hour < 24; hour++ {
+			if mean, ok := heatmap.Mean(row, hour); ok {
+				pdf.SetFillColor(heatmapColor(mean, low, max))
+			} else {
+				pdf.SetFillColor(int(heatmapNoData[0]), int(heatmapNoData[1]), int(heatmapNoData[2]))
+			}
+			pdf.CellFormat(heatmapCellWidth, heatmapCellHeight, "", "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	// Scale in ten steps
+	pdf.Ln(4)
+	pdf.CellFormat(heatmapLabelWidth, 6, strings.TrimSpace(formatter(low)), "", 0, "R", false, 0, "")
+	for i := 0; i < 10; i++ {
+		pdf.SetFillColor(heatmapColor(low+(max-low)*float64(i)/9, low, max))
+		pdf.CellFormat(heatmapCellWidth, 6, "", "1", 0, "C", true, 0, "")
+	}
+	pdf.CellFormat(0, 6, " "+strings.TrimSpace(formatter(max)), "", 1, "L", false, 0, "")
+	pdf.SetFillColor(255, 255, 255)
+	pdf.CellFormat(0, 6, "Gray cells have no data", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Times", "B", 16)
+}
+
+// One page per metric of every chapter, pooling the instances of its
+// sections
+func (g *GCSExporter) writeFleetHeatmaps(pdf *gofpdf.Fpdf, chapters []reportChapter) {
+	for _, chapter := range chapters {
+		for _, metric := range chapter.Metrics {
+			var pooled *analysis.Heatmap
+			instances := 0
+			for _, section := range chapter.Sections {
+				fleet, ok := section.FleetHeatmaps[metric.Name]
+				if !ok {
+					continue
+				}
+
+				if pooled == nil {
+					pooled = analysis.NewHeatmap(fleet.Heatmap.WeekStart)
+				}
+				pooled.Merge(fleet.Heatmap)
+				instances += fleet.Instances
+			}
+			if pooled == nil {
+				continue
+			}
+
+			g.writeHeatmap(pdf, fmt.Sprintf("%s: %s of %d instance(s)", chapter.Title, metric.Title, instances), metric, pooled)
+		}
+	}
+}
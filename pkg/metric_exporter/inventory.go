@@ -0,0 +1,225 @@
+package metric_exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/jung-kurt/gofpdf"
+
+	"stackdriver-monitoring-simple-reporter/pkg/gcp"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Instance Inventory(CSV)
+
+************************************************/
+
+var inventoryCSVHeader = []string{"name", "id", "zone", "machine_type", "status", "created", "labels", "cpus", "memory_mb"}
+
+func (g *GCSExporter) saveInventoryToCSV(filename string, instances []gcp.Instance) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(inventoryCSVHeader)
+	for _, instance := range instances {
+		cw.Write([]string{
+			instance.Name,
+			instance.ID,
+			instance.Zone,
+			instance.MachineType,
+			instance.Status,
+			instance.CreationTimestamp,
+			formatLabels(instance.Labels),
+			strconv.FormatInt(instance.CPUs, 10),
+			strconv.FormatInt(instance.MemoryMB, 10),
+		})
+	}
+	cw.Flush()
+
+	g.writeObject(filename, &buf)
+}
+
+// Missing file means the stuff job did not list the instances
+func (g *GCSExporter) loadInventory(ctx context.Context, bh *storage.BucketHandle, basePath string) (instances []gcp.Instance) {
+	r, err := bh.Object(inventoryPath(basePath)).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read inventory: %v", err)
+	}
+	defer r.Close()
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		log.Fatalf("Failed to parse inventory: %v", err)
+	}
+
+	// Skip header
+	for i := 1; i < len(records); i++ {
+		// Older files end with the labels
+		if len(records[i]) < len(inventoryCSVHeader)-2 {
+			continue
+		}
+
+		instance := gcp.Instance{
+			Name:              records[i][0],
+			ID:                records[i][1],
+			Zone:              records[i][2],
+			MachineType:       records[i][3],
+			Status:            records[i][4],
+			CreationTimestamp: records[i][5],
+			Labels:            parseLabels(records[i][6]),
+		}
+		if len(records[i]) >= len(inventoryCSVHeader) {
+			instance.CPUs, _ = strconv.ParseInt(records[i][7], 10, 64)
+			instance.MemoryMB, _ = strconv.ParseInt(records[i][8], 10, 64)
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return
+}
+
+func inventoryPath(basePath string) string {
+	return fmt.Sprintf("%s/instances.csv", basePath)
+}
+
+// e.g. env=prod;team=web
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ";")
+}
+
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		if idx := strings.Index(pair, "="); idx > 0 {
+			labels[pair[:idx]] = pair[idx+1:]
+		}
+	}
+
+	return labels
+}
+
+func (g *GCSExporter) ExportInventory(p period.Period, projectID string, instances []gcp.Instance) {
+	g.saveInventoryToCSV(inventoryPath(basePathOfReportStuff(projectID, p)), instances)
+}
+
+/************************************************
+
+Instances Without Data(PDF)
+
+************************************************/
+
+// noDataInstance is an instance of the inventory missing some or all of its
+// metrics, with the likely reason.
+type noDataInstance struct {
+	Instance gcp.Instance
+	Metrics  []string
+	Reason   string
+}
+
+// Compare the inventory with the exported CSV files of the GCE metrics
+func (g *GCSExporter) noDataInstances(ctx context.Context, bh *storage.BucketHandle, basePath string) (instances []noDataInstance) {
+	inventory := g.loadInventory(ctx, bh, basePath)
+	if len(inventory) == 0 {
+		return
+	}
+
+	csvPathMaps := g.getCSVPathMaps(ctx, bh, basePath)
+
+	for _, instance := range inventory {
+		csvPaths := csvPathMaps[fmt.Sprintf("[%s]", instance.Key())]
+
+		var missing []string
+		agentOnly := true
+		for _, metric := range g.Metrics {
+			if metric.Resource != stackdriver.ResourceGCEInstance {
+				continue
+			}
+			if _, ok := csvPaths[metric.Name]; ok {
+				continue
+			}
+
+			missing = append(missing, metric.Name)
+			if !isAgentMetric(metric) {
+				agentOnly = false
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		instances = append(instances, noDataInstance{
+			Instance: instance,
+			Metrics:  missing,
+			Reason:   noDataReason(instance, len(csvPaths) == 0, agentOnly),
+		})
+	}
+
+	return
+}
+
+// Display names of the instances keyed like the image readers, e.g.
+// [asia-east1-a_1234567890123456789] -> web-1 (asia-east1-a)
+func instanceNames(instances []gcp.Instance) map[string]string {
+	names := make(map[string]string)
+	for _, instance := range instances {
+		names[fmt.Sprintf("[%s]", instance.Key())] = fmt.Sprintf("%s (%s)", instance.Name, instance.Zone)
+	}
+
+	return names
+}
+
+func isAgentMetric(metric utils.MetricConf) bool {
+	return strings.HasPrefix(metric.Type, "agent.googleapis.com/")
+}
+
+func noDataReason(instance gcp.Instance, noData, agentOnly bool) string {
+	switch {
+	case noData && instance.Status == gcp.InstanceStatusUnknown:
+		return "no data, the Compute Engine API could not tell the instance status"
+	case noData && instance.Status != gcp.InstanceStatusRunning:
+		return fmt.Sprintf("no data, the instance is %s", instance.Status)
+	case noData:
+		return fmt.Sprintf("no data although running, created %s", instance.CreationTimestamp)
+	case agentOnly:
+		return "no agent metrics, is the monitoring agent installed?"
+	}
+
+	return "no data for some metrics"
+}
+
+func writeNoDataInstances(pdf *gofpdf.Fpdf, instances []noDataInstance) {
+	if len(instances) == 0 {
+		return
+	}
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(0, 10, "Instances Without Data", "", 1, "L", false, 0, "")
+
+	for _, instance := range instances {
+		pdf.SetFont("Times", "B", 12)
+		pdf.CellFormat(0, 8, fmt.Sprintf("%s (%s, %s, %s)", instance.Instance.Name, instance.Instance.Zone, instance.Instance.MachineType, instance.Instance.Status), "", 1, "L", false, 0, "")
+		pdf.SetFont("Times", "", 12)
+		pdf.MultiCell(0, 6, fmt.Sprintf("%s: %s", instance.Reason, strings.Join(instance.Metrics, ", ")), "", "L", false)
+	}
+}
@@ -2,17 +2,26 @@ package metric_exporter
 
 import (
 	"context"
-	"time"
+
+	"stackdriver-monitoring-simple-reporter/pkg/gcp"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
 )
 
 type MetricExporter interface {
-	ExportWeeklyMetrics(dateTime time.Time, projectID, metric, instanceName string, metricPoints []string)
-	ExportWeeklyMetricsChart(startDate time.Time, projectID, metric, instanceName string, xValues []time.Time, yValues []float64, totalHour int)
-	ExportWeeklyReport(projectID string, startDate time.Time)
-	SendWeeklyReport(appCtx context.Context, projectID, mailReceiver string, startDate time.Time)
-
-	ExportMonthlyMetrics(dateTime time.Time, projectID, metric, instanceName string, metricPoints []string)
-	ExportMonthlyMetricsChart(startDate time.Time, projectID, metric, instanceName string, xValues []time.Time, yValues []float64, totalHour int)
-	ExportMonthlyReport(projectID string, startDate time.Time)
-	SendMonthlyReport(appCtx context.Context, projectID, mailReceiver string, startDate time.Time)
+	ExportMetrics(p period.Period, projectID string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints)
+	ExportPriorMetrics(p, prior period.Period, projectID string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints)
+	ExportMetricsChart(p period.Period, projectID string, metric utils.MetricConf, instanceName string, series []stackdriver.TimeSeriesPoints)
+	ExportListStats(p period.Period, projectID string, listStats []stackdriver.ListStats)
+	ExportInventory(p period.Period, projectID string, instances []gcp.Instance)
+	ExportReport(projectID string, p period.Period, comparisonStats []stackdriver.ListStats)
+	ExportTasksEnqueued(p period.Period, projectID, run string, tasks int)
+	ExportTaskDone(p period.Period, projectID, run, task string, stats stackdriver.ListStats)
+	HasStuff(p period.Period, projectID string) bool
+	HasAllStuff(p period.Period, projectID string) bool
+	HasMetrics(p period.Period, projectID string, metric utils.MetricConf, instanceName string) bool
+	HasPriorMetrics(p, prior period.Period, projectID string, metric utils.MetricConf, instanceName string) bool
+	HasReport(projectID string, p period.Period) bool
+	SendReport(appCtx context.Context, projectID, mailReceiver string, p period.Period)
 }
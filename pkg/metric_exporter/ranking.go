@@ -0,0 +1,192 @@
+package metric_exporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Ranking
+
+************************************************/
+
+// instanceRank is one row of a ranking, Key is the one of the image readers
+type instanceRank struct {
+	Key   string
+	Name  string
+	Stats analysis.Stats
+}
+
+// ranking of the GCE instances by one metric, the highest first in Top and
+// the lowest first in Bottom
+type ranking struct {
+	Metric utils.MetricConf
+	Top    []instanceRank
+	Bottom []instanceRank
+}
+
+func (g *GCSExporter) rankValue(stats analysis.Stats) float64 {
+	if g.Ranking.RankBy == utils.RankByMean {
+		return stats.Mean
+	}
+
+	return stats.P95
+}
+
+// Rankings of the GCE chapter by the CPU and memory metrics, from the
+// statistics of the first series of each instance. Bottom holds the instances
+// below Top only, it is empty when Top already holds every instance.
+func (g *GCSExporter) rankInstances(chapters []reportChapter) (rankings []ranking) {
+	if g.Ranking.Disabled {
+		return
+	}
+
+	for _, chapter := range chapters {
+		if chapter.Resource != stackdriver.ResourceGCEInstance {
+			continue
+		}
+
+		for _, metricName := range g.Ranking.Metrics() {
+			for _, metric := range chapter.Metrics {
+				if metric.Name != metricName {
+					continue
+				}
+
+				var ranks []instanceRank
+				for _, section := range chapter.Sections {
+					for _, key := range section.Keys {
+						summaries := section.Summaries[key][metric.Name]
+						if len(summaries) == 0 {
+							continue
+						}
+
+						ranks = append(ranks, instanceRank{
+							Key:   key,
+							Name:  displayName(key, section.Names),
+							Stats: summaries[0].Stats,
+						})
+					}
+				}
+				if len(ranks) == 0 {
+					continue
+				}
+
+				sort.SliceStable(ranks, func(i, j int) bool {
+					return g.rankValue(ranks[i].Stats) > g.rankValue(ranks[j].Stats)
+				})
+
+				r := ranking{Metric: metric, Top: ranks}
+				if len(ranks) > g.Ranking.Count {
+					r.Top = ranks[:g.Ranking.Count]
+					from := len(ranks) - g.Ranking.Count
+					if from < g.Ranking.Count {
+						from = g.Ranking.Count
+					}
+					for i := len(ranks) - 1; i >= from; i-- {
+						r.Bottom = append(r.Bottom, ranks[i])
+					}
+				}
+				rankings = append(rankings, r)
+			}
+		}
+	}
+
+	return
+}
+
+// Keys of the instances in any top list
+func topKeys(rankings []ranking) map[string]bool {
+	keys := make(map[string]bool)
+	for _, r := range rankings {
+		for _, rank := range r.Top {
+			keys[rank.Key] = true
+		}
+	}
+
+	return keys
+}
+
+// Internal links to the first chart page of every GCE instance which has
+// one, details limits the instances when it is not nil
+func instanceLinks(pdf *gofpdf.Fpdf, chapters []reportChapter, details map[string]bool) map[string]int {
+	links := make(map[string]int)
+	for _, chapter := range chapters {
+		if chapter.Resource != stackdriver.ResourceGCEInstance {
+			continue
+		}
+
+		for _, section := range chapter.Sections {
+			for _, key := range section.Keys {
+				if details == nil || details[key] {
+					links[key] = pdf.AddLink()
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+var rankingTableHeader = []string{"#", "Instance", "Mean", "P95"}
+
+var rankingTableWidths = []float64{10, 100, 40, 40}
+
+// The top and bottom tables of every ranking, the names link to the chart
+// pages
+func (g *GCSExporter) writeRanking(pdf *gofpdf.Fpdf, rankings []ranking, links map[string]int) {
+	if len(rankings) == 0 {
+		return
+	}
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(0, 10, "Instance Ranking", "", 1, "L", false, 0, "")
+
+	for _, r := range rankings {
+		writeRankingTable(pdf, fmt.Sprintf("Highest %s (%s)", r.Metric.Title, g.Ranking.RankBy), r.Metric, r.Top, links)
+		writeRankingTable(pdf, fmt.Sprintf("Lowest %s (%s)", r.Metric.Title, g.Ranking.RankBy), r.Metric, r.Bottom, links)
+	}
+
+	pdf.SetFont("Times", "B", 16)
+}
+
+func writeRankingTable(pdf *gofpdf.Fpdf, title string, metric utils.MetricConf, ranks []instanceRank, links map[string]int) {
+	if len(ranks) == 0 {
+		return
+	}
+
+	formatter := utils.GetValueFormatter(metric.Unit)
+
+	pdf.Ln(2)
+	pdf.SetFont("Times", "B", 12)
+	pdf.CellFormat(0, 8, title, "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Times", "B", 9)
+	for i, header := range rankingTableHeader {
+		pdf.CellFormat(rankingTableWidths[i], 6, header, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Times", "", 9)
+	for i, rank := range ranks {
+		pdf.CellFormat(rankingTableWidths[0], 6, fmt.Sprintf("%d", i+1), "1", 0, "R", false, 0, "")
+
+		link, ok := links[rank.Key]
+		if ok {
+			pdf.SetTextColor(0, 0, 200)
+		}
+		pdf.CellFormat(rankingTableWidths[1], 6, rank.Name, "1", 0, "L", false, link, "")
+		pdf.SetTextColor(0, 0, 0)
+
+		pdf.CellFormat(rankingTableWidths[2], 6, strings.TrimSpace(formatter(rank.Stats.Mean)), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(rankingTableWidths[3], 6, strings.TrimSpace(formatter(rank.Stats.P95)), "1", 1, "R", false, 0, "")
+	}
+}
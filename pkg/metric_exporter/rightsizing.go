@@ -0,0 +1,180 @@
+package metric_exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp"
+	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
+)
+
+/************************************************
+
+Rightsizing
+
+************************************************/
+
+// instanceRecommendation is the rightsizing recommendation of one instance
+// of the inventory
+type instanceRecommendation struct {
+	Instance       gcp.Instance
+	Usage          analysis.Usage
+	Recommendation analysis.Recommendation
+}
+
+// Recommendations for the running instances of the inventory, and those of
+// unknown status, from the statistics of the CPU and memory metrics in the
+// GCE chapter. Instances without CPU data or machine type size are left out.
+func (g *GCSExporter) rightsize(chapters []reportChapter, inventory []gcp.Instance) (recommendations []instanceRecommendation) {
+	var summaries map[string]map[string][]seriesSummary
+	for _, chapter := range chapters {
+		if chapter.Resource == stackdriver.ResourceGCEInstance && len(chapter.Sections) > 0 {
+			summaries = chapter.Sections[0].Summaries
+		}
+	}
+	if summaries == nil {
+		return
+	}
+
+	for _, instance := range inventory {
+		if instance.Status != gcp.InstanceStatusRunning && instance.Status != gcp.InstanceStatusUnknown {
+			continue
+		}
+
+		usage := analysis.Usage{CPUs: instance.CPUs, MemoryMB: instance.MemoryMB}
+		key := fmt.Sprintf("[%s]", instance.Key())
+		if cpu := summaries[key][g.Rightsizing.CPUMetric]; len(cpu) > 0 {
+			usage.CPU, usage.HasCPU = cpu[0].Stats, true
+		}
+		if memory := summaries[key][g.Rightsizing.MemoryMetric]; len(memory) > 0 {
+			usage.Memory, usage.HasMemory = memory[0].Stats, true
+		}
+		if !usage.HasCPU || instance.CPUs == 0 {
+			continue
+		}
+
+		recommendations = append(recommendations, instanceRecommendation{
+			Instance:       instance,
+			Usage:          usage,
+			Recommendation: analysis.Recommend(usage, g.Rightsizing.Thresholds()),
+		})
+	}
+
+	return
+}
+
+// e.g. 4 vCPUs, 15.0 GB
+func formatSize(cpus, memoryMB int64) string {
+	return fmt.Sprintf("%d vCPUs, %.1f GB", cpus, float64(memoryMB)/1024)
+}
+
+var rightsizingTableHeader = []string{"Instance", "Machine type", "CPU p95", "Memory p95", "Action", "Suggested"}
+
+var rightsizingTableWidths = []float64{50, 30, 20, 22, 20, 48}
+
+// A table of every instance, then the evidence of those to resize
+func writeRightsizing(pdf *gofpdf.Fpdf, recommendations []instanceRecommendation) {
+	if len(recommendations) == 0 {
+		return
+	}
+
+	pdf.AddPage()
+	pdf.SetFont("Times", "B", 20)
+	pdf.CellFormat(0, 10, "Rightsizing", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Times", "B", 9)
+	for i, title := range rightsizingTableHeader {
+		pdf.CellFormat(rightsizingTableWidths[i], 6, title, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Times", "", 9)
+	for _, r := range recommendations {
+		memory := "n/a"
+		if r.Usage.HasMemory {
+			memory = fmt.Sprintf("%.0f%%", r.Recommendation.MemoryUtilization*100)
+		}
+		suggested := ""
+		if r.Recommendation.Action != analysis.ActionKeep {
+			suggested = formatSize(r.Recommendation.SuggestedCPUs, r.Recommendation.SuggestedMemoryMB)
+		}
+
+		row := []string{
+			fmt.Sprintf("%s (%s)", r.Instance.Name, r.Instance.Zone),
+			r.Instance.MachineType,
+			fmt.Sprintf("%.0f%%", r.Recommendation.CPUUtilization*100),
+			memory,
+			r.Recommendation.Action,
+			suggested,
+		}
+		for i, value := range row {
+			pdf.CellFormat(rightsizingTableWidths[i], 6, value, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	pdf.Ln(4)
+	for _, r := range recommendations {
+		if r.Recommendation.Action == analysis.ActionKeep {
+			continue
+		}
+
+		pdf.SetFont("Times", "B", 12)
+		pdf.CellFormat(0, 8, fmt.Sprintf("%s %s: %s -> %s", r.Recommendation.Action, r.Instance.Name, formatSize(r.Instance.CPUs, r.Instance.MemoryMB), formatSize(r.Recommendation.SuggestedCPUs, r.Recommendation.SuggestedMemoryMB)), "", 1, "L", false, 0, "")
+		pdf.SetFont("Times", "", 12)
+		pdf.MultiCell(0, 6, r.Recommendation.Summary(), "", "L", false)
+	}
+}
+
+/************************************************
+
+Rightsizing(CSV)
+
+************************************************/
+
+var rightsizingCSVHeader = []string{"instance", "name", "zone", "machine_type", "cpus", "memory_mb", "cpu_mean", "cpu_p95", "cpu_p95_utilization", "memory_mean", "memory_p95", "memory_p95_utilization", "action", "suggested_cpus", "suggested_memory_mb", "reason"}
+
+func rightsizingPath(basePath string) string {
+	return fmt.Sprintf("%s/rightsizing.csv", basePath)
+}
+
+// Memory columns are empty without memory data
+func (g *GCSExporter) saveRightsizingToCSV(filename string, recommendations []instanceRecommendation) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(rightsizingCSVHeader)
+	for _, r := range recommendations {
+		memoryMean, memoryP95, memoryUtilization := "", "", ""
+		if r.Usage.HasMemory {
+			memoryMean = fmt.Sprintf("%f", r.Usage.Memory.Mean)
+			memoryP95 = fmt.Sprintf("%f", r.Usage.Memory.P95)
+			memoryUtilization = fmt.Sprintf("%f", r.Recommendation.MemoryUtilization)
+		}
+
+		cw.Write([]string{
+			r.Instance.Key(),
+			r.Instance.Name,
+			r.Instance.Zone,
+			r.Instance.MachineType,
+			fmt.Sprintf("%d", r.Instance.CPUs),
+			fmt.Sprintf("%d", r.Instance.MemoryMB),
+			fmt.Sprintf("%f", r.Usage.CPU.Mean),
+			fmt.Sprintf("%f", r.Usage.CPU.P95),
+			fmt.Sprintf("%f", r.Recommendation.CPUUtilization),
+			memoryMean,
+			memoryP95,
+			memoryUtilization,
+			r.Recommendation.Action,
+			fmt.Sprintf("%d", r.Recommendation.SuggestedCPUs),
+			fmt.Sprintf("%d", r.Recommendation.SuggestedMemoryMB),
+			r.Recommendation.Summary(),
+		})
+	}
+	cw.Flush()
+
+	g.writeObject(filename, &buf)
+}
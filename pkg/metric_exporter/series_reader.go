@@ -0,0 +1,111 @@
+package metric_exporter
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+/************************************************
+
+Report Helper(CSV)
+
+************************************************/
+
+// SeriesValues is a time series read back from its exported CSV, only the
+// points with a value are kept.
+type SeriesValues struct {
+	Name    string
+	XValues []time.Time
+	YValues []float64
+	Total   int
+}
+
+// CSV paths of each instance keyed by metric name, the instance key is
+// bracketed like the image reader keys.
+func (g *GCSExporter) getCSVPathMaps(ctx context.Context, bh *storage.BucketHandle, basePath string) map[string]map[string][]string {
+	csvPathMaps := make(map[string]map[string][]string)
+	r := regexp.MustCompile(`\[(\w|-)+\]`)
+
+	q := &storage.Query{Prefix: fmt.Sprintf("%s/", basePath), Delimiter: "/"}
+	it := bh.Objects(ctx, q)
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Failed to list files: %v", err)
+		}
+
+		if !strings.HasSuffix(objAttrs.Name, ".csv") {
+			continue
+		}
+
+		parts := r.FindAllString(objAttrs.Name, -1)
+		if len(parts) < 2 {
+			continue
+		}
+
+		instanceName := parts[0]
+		metricName := strings.Trim(parts[1], "[]")
+
+		if _, ok := csvPathMaps[instanceName]; !ok {
+			csvPathMaps[instanceName] = make(map[string][]string)
+		}
+		csvPathMaps[instanceName][metricName] = append(csvPathMaps[instanceName][metricName], objAttrs.Name)
+	}
+
+	return csvPathMaps
+}
+
+// Times are in the report location
+func (g *GCSExporter) loadSeriesValues(ctx context.Context, bh *storage.BucketHandle, path string) (series SeriesValues) {
+	r, err := bh.Object(path).NewReader(ctx)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+	defer r.Close()
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		log.Fatalf("Failed to parse %s: %v", path, err)
+	}
+
+	// [instance_name][metric][series]
+	parts := regexp.MustCompile(`\[(\w|-)+\]`).FindAllString(path, -1)
+	if len(parts) > 2 {
+		series.Name = strings.Trim(parts[2], "[]")
+	}
+
+	// Skip header
+	for i := 1; i < len(records); i++ {
+		series.Total++
+
+		if len(records[i]) < 3 || records[i][2] == "" {
+			continue
+		}
+
+		timestamp, err := strconv.ParseInt(records[i][0], 10, 64)
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(records[i][2], 64)
+		if err != nil {
+			continue
+		}
+
+		series.XValues = append(series.XValues, time.Unix(timestamp, 0).In(g.Location))
+		series.YValues = append(series.YValues, value)
+	}
+
+	return
+}
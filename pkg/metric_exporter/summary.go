@@ -0,0 +1,176 @@
+package metric_exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/jung-kurt/gofpdf"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+	"stackdriver-monitoring-simple-reporter/pkg/utils"
+)
+
+/************************************************
+
+Summary Statistics
+
+************************************************/
+
+// seriesSummary is the statistics of one series under a chart, Name is empty
+// when the chart has a single series
+type seriesSummary struct {
+	Name  string
+	Stats analysis.Stats
+}
+
+// Series of each instance keyed by metric name, read back from the CSVs of
+// the metrics
+func (g *GCSExporter) loadSectionSeries(ctx context.Context, bh *storage.BucketHandle, metrics []utils.MetricConf, csvPathMaps map[string]map[string][]string) map[string]map[string][]SeriesValues {
+	seriesMaps := make(map[string]map[string][]SeriesValues)
+
+	for instanceName, csvPathMap := range csvPathMaps {
+		seriesMaps[instanceName] = make(map[string][]SeriesValues)
+
+		for _, metric := range metrics {
+			for _, path := range csvPathMap[metric.Name] {
+				seriesMaps[instanceName][metric.Name] = append(seriesMaps[instanceName][metric.Name], g.loadSeriesValues(ctx, bh, path))
+			}
+		}
+	}
+
+	return seriesMaps
+}
+
+// Statistics of each instance keyed by metric name, series without a value
+// are left out
+func summarizeSeries(seriesMaps map[string]map[string][]SeriesValues) map[string]map[string][]seriesSummary {
+	summaries := make(map[string]map[string][]seriesSummary)
+
+	for instanceName, seriesMap := range seriesMaps {
+		summaries[instanceName] = make(map[string][]seriesSummary)
+
+		for metricName, seriesList := range seriesMap {
+			for _, series := range seriesList {
+				stats, ok := analysis.Summarize(series.XValues, series.YValues, series.Total)
+				if !ok {
+					continue
+				}
+
+				summaries[instanceName][metricName] = append(summaries[instanceName][metricName], seriesSummary{
+					Name:  series.Name,
+					Stats: stats,
+				})
+			}
+		}
+	}
+
+	return summaries
+}
+
+var statsTableHeader = []string{"Series", "Min", "Max", "Mean", "P50", "P95", "P99", "Coverage", "Peak at"}
+
+// Column widths in mm, 190 fits an A4 page between the default margins
+var statsTableWidths = []float64{38, 19, 19, 19, 19, 19, 19, 16, 22}
+
+// One row per series under its chart, values in the unit of the metric
+func writeStatsTable(pdf *gofpdf.Fpdf, metric utils.MetricConf, summaries []seriesSummary) {
+	if len(summaries) == 0 {
+		return
+	}
+
+	formatter := utils.GetValueFormatter(metric.Unit)
+	format := func(v float64) string {
+		return strings.TrimSpace(formatter(v))
+	}
+
+	pdf.SetFont("Times", "B", 8)
+	for i, title := range statsTableHeader {
+		pdf.CellFormat(statsTableWidths[i], 5, title, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Times", "", 8)
+	for _, summary := range summaries {
+		name := summary.Name
+		if name == "" {
+			name = metric.Title
+		}
+
+		stats := summary.Stats
+		row := []string{
+			name,
+			format(stats.Min),
+			format(stats.Max),
+			format(stats.Mean),
+			format(stats.P50),
+			format(stats.P95),
+			format(stats.P99),
+			fmt.Sprintf("%.1f%%", stats.Coverage),
+			stats.PeakTime.Format("01/02 15:04"),
+		}
+		for i, value := range row {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(statsTableWidths[i], 5, value, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	pdf.SetFont("Times", "B", 16)
+}
+
+/************************************************
+
+Summary Statistics(CSV)
+
+************************************************/
+
+var summaryCSVHeader = []string{"chapter", "section", "instance", "name", "metric", "series", "count", "min", "max", "mean", "p50", "p95", "p99", "coverage", "peak_time"}
+
+func summaryPath(basePath string) string {
+	return fmt.Sprintf("%s/summary.csv", basePath)
+}
+
+// Every series of the report in the order of its pages
+func (g *GCSExporter) saveSummaryToCSV(filename string, chapters []reportChapter) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(summaryCSVHeader)
+	for _, chapter := range chapters {
+		for _, section := range chapter.Sections {
+			for _, key := range section.Keys {
+				for _, metric := range chapter.Metrics {
+					for _, summary := range section.Summaries[key][metric.Name] {
+						stats := summary.Stats
+						cw.Write([]string{
+							chapter.Title,
+							section.Title,
+							strings.Trim(key, "[]"),
+							displayName(key, section.Names),
+							metric.Name,
+							summary.Name,
+							fmt.Sprintf("%d", stats.Count),
+							fmt.Sprintf("%f", stats.Min),
+							fmt.Sprintf("%f", stats.Max),
+							fmt.Sprintf("%f", stats.Mean),
+							fmt.Sprintf("%f", stats.P50),
+							fmt.Sprintf("%f", stats.P95),
+							fmt.Sprintf("%f", stats.P99),
+							fmt.Sprintf("%.1f", stats.Coverage),
+							stats.PeakTime.Format("2006-01-02 15:04:05"),
+						})
+					}
+				}
+			}
+		}
+	}
+	cw.Flush()
+
+	g.writeObject(filename, &buf)
+}
@@ -0,0 +1,243 @@
+package period
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	Daily     = "daily"
+	Weekly    = "weekly"
+	Monthly   = "monthly"
+	Quarterly = "quarterly"
+	Yearly    = "yearly"
+)
+
+// Ranges in the order of their length
+var Ranges = []string{Daily, Weekly, Monthly, Quarterly, Yearly}
+
+// Alignment period of a range unless the metric sets one for the range.
+// Weekly and monthly use the alignment period of the metric.
+var alignmentPeriods = map[string]string{
+	Daily:     "300s",
+	Quarterly: "21600s",
+	Yearly:    "86400s",
+}
+
+func Valid(dataRange string) bool {
+	for _, r := range Ranges {
+		if r == dataRange {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Calendar is the business calendar of the periods. Weeks start on WeekStart,
+// Sunday by default. ISOWeek names weeks by their ISO 8601 number, e.g.
+// 2018-W44, and needs weeks starting on Monday.
+type Calendar struct {
+	WeekStart time.Weekday
+	ISOWeek   bool
+}
+
+// Period is the interval of one report, from local midnight Start up to End.
+type Period struct {
+	Range    string
+	Start    time.Time
+	End      time.Time
+	Calendar Calendar
+}
+
+// Of returns the period of a range which contains day, in the location of
+// day
+func (c Calendar) Of(dataRange string, day time.Time) Period {
+	local := day.Location()
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, local)
+
+	p := Period{Range: dataRange, Calendar: c}
+	switch dataRange {
+	case Daily:
+		p.Start = midnight
+		p.End = midnight.AddDate(0, 0, 1)
+	case Monthly:
+		p.Start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, local)
+		p.End = p.Start.AddDate(0, 1, 0)
+	case Quarterly:
+		p.Start = time.Date(day.Year(), day.Month()-(day.Month()-1)%3, 1, 0, 0, 0, 0, local)
+		p.End = p.Start.AddDate(0, 3, 0)
+	case Yearly:
+		p.Start = time.Date(day.Year(), 1, 1, 0, 0, 0, 0, local)
+		p.End = p.Start.AddDate(1, 0, 0)
+	default:
+		// A week across a DST change is 167 or 169 hours long
+		p.Range = Weekly
+		p.Start = midnight.AddDate(0, 0, -(int)((day.Weekday()-c.WeekStart+7)%7))
+		p.End = p.Start.AddDate(0, 0, 7)
+	}
+
+	return p
+}
+
+// Previous returns the last complete period before now
+func (c Calendar) Previous(dataRange string, now time.Time) Period {
+	return c.Of(dataRange, c.Of(dataRange, now).Start.AddDate(0, 0, -1))
+}
+
+// Next returns the period right after p
+func (p Period) Next() Period {
+	return p.Calendar.Of(p.Range, p.End)
+}
+
+// Previous returns the period right before p, an explicit interval is
+// shifted back by its length
+func (p Period) Previous() Period {
+	if !p.isRegular() {
+		return Period{Range: p.Range, Start: p.Start.Add(-p.End.Sub(p.Start)), End: p.Start, Calendar: p.Calendar}
+	}
+
+	return p.Calendar.Of(p.Range, p.Start.AddDate(0, 0, -1))
+}
+
+// YearAgo returns the same period a year earlier
+func (p Period) YearAgo() Period {
+	if !p.isRegular() {
+		return Period{Range: p.Range, Start: p.Start.AddDate(-1, 0, 0), End: p.End.AddDate(-1, 0, 0), Calendar: p.Calendar}
+	}
+
+	return p.Calendar.Of(p.Range, p.Start.AddDate(-1, 0, 0))
+}
+
+// Whether p is a whole period of its range rather than an explicit interval
+func (p Period) isRegular() bool {
+	regular := p.Calendar.Of(p.Range, p.Start)
+	return regular.Start.Equal(p.Start) && regular.End.Equal(p.End)
+}
+
+// Comparison is an earlier period a report is compared with
+type Comparison struct {
+	Name   string
+	Period Period
+}
+
+// Comparisons of the period, the previous one and, for a month, the same
+// month last year
+func (p Period) Comparisons() []Comparison {
+	comparisons := []Comparison{{Name: "previous " + nouns[p.Range], Period: p.Previous()}}
+	if p.Range == Monthly {
+		comparisons = append(comparisons, Comparison{Name: "same month last year", Period: p.YearAgo()})
+	}
+
+	return comparisons
+}
+
+var nouns = map[string]string{
+	Daily:     "day",
+	Weekly:    "week",
+	Monthly:   "month",
+	Quarterly: "quarter",
+	Yearly:    "year",
+}
+
+// Year of the folder of the period, the ISO year of an ISO week
+func (p Period) Year() int {
+	if p.isISOWeek() {
+		year, _ := p.Start.ISOWeek()
+		return year
+	}
+
+	return p.Start.Year()
+}
+
+// An explicit interval which is not a whole week keeps its dates
+func (p Period) isISOWeek() bool {
+	return p.Range == Weekly && p.Calendar.ISOWeek &&
+		p.Start.Weekday() == time.Monday && p.End.Equal(p.Start.AddDate(0, 0, 7))
+}
+
+// e.g. 2018-W44
+func (p Period) isoWeekLabel() string {
+	year, week := p.Start.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// AlignmentPeriod is the default alignment period of the range, empty when
+// the metric's one is used
+func (p Period) AlignmentPeriod() string {
+	return alignmentPeriods[p.Range]
+}
+
+// Label names the folder and files of the period, e.g. 2018-10-28 (daily),
+// 2018-1028-1104 or 2018-W44 (weekly), 2018-10 (monthly), 2018-Q4
+// (quarterly) or 2018 (yearly). An explicit interval is named by its dates,
+// e.g. 2018-1005-1020, never like a whole period of its range.
+func (p Period) Label() string {
+	if p.isISOWeek() {
+		return p.isoWeekLabel()
+	}
+	if !p.isRegular() {
+		return p.intervalLabel()
+	}
+
+	switch p.Range {
+	case Daily:
+		return p.Start.Format("2006-01-02")
+	case Monthly:
+		return p.Start.Format("2006-01")
+	case Quarterly:
+		return fmt.Sprintf("%d-Q%d", p.Start.Year(), p.quarter())
+	case Yearly:
+		return p.Start.Format("2006")
+	}
+
+	return p.intervalLabel()
+}
+
+// e.g. 2018-1028-1104, an interval ending in another year names it, e.g.
+// 2017-0301-2018-0301
+func (p Period) intervalLabel() string {
+	if p.isRegular() || p.End.Year() == p.Start.Year() {
+		return fmt.Sprintf("%s-%s", p.Start.Format("2006-0102"), p.End.Format("0102"))
+	}
+
+	return fmt.Sprintf("%s-%s", p.Start.Format("2006-0102"), p.End.Format("2006-0102"))
+}
+
+// Dates of the period in report titles, e.g. 2018/10/28 - 2018/11/04 or
+// 2018-W44 (2018/10/29 - 2018/11/05)
+func (p Period) Dates() string {
+	if p.isISOWeek() {
+		return fmt.Sprintf("%s (%s - %s)", p.isoWeekLabel(), p.Start.Format("2006/01/02"), p.End.Format("2006/01/02"))
+	}
+	if !p.isRegular() {
+		return p.intervalDates()
+	}
+
+	switch p.Range {
+	case Daily:
+		return p.Start.Format("2006/01/02")
+	case Monthly:
+		return p.Start.Format("2006/01")
+	case Quarterly:
+		return fmt.Sprintf("%d Q%d", p.Start.Year(), p.quarter())
+	case Yearly:
+		return p.Start.Format("2006")
+	}
+
+	return p.intervalDates()
+}
+
+func (p Period) intervalDates() string {
+	return fmt.Sprintf("%s - %s", p.Start.Format("2006/01/02"), p.End.Format("2006/01/02"))
+}
+
+// Name of the range in report titles, e.g. Weekly
+func (p Period) Name() string {
+	return strings.Title(p.Range)
+}
+
+func (p Period) quarter() int {
+	return int(p.Start.Month()-1)/3 + 1
+}
@@ -0,0 +1,197 @@
+package period
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestExplicitLabel(t *testing.T) {
+	c := Calendar{WeekStart: time.Monday, ISOWeek: true}
+	tests := []struct {
+		p     Period
+		label string
+		dates string
+	}{
+		{Period{Range: Daily, Start: date(2018, 10, 5), End: date(2018, 10, 8), Calendar: c}, "2018-1005-1008", "2018/10/05 - 2018/10/08"},
+		{Period{Range: Monthly, Start: date(2018, 10, 5), End: date(2018, 10, 20), Calendar: c}, "2018-1005-1020", "2018/10/05 - 2018/10/20"},
+		{Period{Range: Monthly, Start: date(2018, 10, 1), End: date(2018, 10, 15), Calendar: c}, "2018-1001-1015", "2018/10/01 - 2018/10/15"},
+		{Period{Range: Quarterly, Start: date(2018, 10, 1), End: date(2018, 12, 1), Calendar: c}, "2018-1001-1201", "2018/10/01 - 2018/12/01"},
+		{Period{Range: Yearly, Start: date(2017, 3, 1), End: date(2018, 3, 1), Calendar: c}, "2017-0301-2018-0301", "2017/03/01 - 2018/03/01"},
+		{Period{Range: Weekly, Start: date(2018, 10, 31), End: date(2018, 11, 5), Calendar: c}, "2018-1031-1105", "2018/10/31 - 2018/11/05"},
+	}
+
+	for _, test := range tests {
+		if label := test.p.Label(); label != test.label {
+			t.Errorf("%s %v: expect label %s, got %s", test.p.Range, test.p.Start, test.label, label)
+		}
+		if dates := test.p.Dates(); dates != test.dates {
+			t.Errorf("%s %v: expect dates %s, got %s", test.p.Range, test.p.Start, test.dates, dates)
+		}
+
+		// Never the label of the regular period it starts in
+		if regular := c.Of(test.p.Range, test.p.Start); regular.Label() == test.p.Label() {
+			t.Errorf("%s %v: expect a label other than %s", test.p.Range, test.p.Start, regular.Label())
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	india := time.FixedZone("UTC+5.5", int(5.5*3600))
+
+	tests := []struct {
+		name      string
+		calendar  Calendar
+		dataRange string
+		day       time.Time
+		start     time.Time
+		end       time.Time
+	}{
+		{"daily", Calendar{}, Daily, time.Date(2018, 10, 31, 13, 0, 0, 0, time.UTC), date(2018, 10, 31), date(2018, 11, 1)},
+		{"weekly from Sunday", Calendar{}, Weekly, date(2018, 10, 31), date(2018, 10, 28), date(2018, 11, 4)},
+		{"weekly from Monday", Calendar{WeekStart: time.Monday}, Weekly, date(2018, 10, 31), date(2018, 10, 29), date(2018, 11, 5)},
+		{"weekly from Wednesday", Calendar{WeekStart: time.Wednesday}, Weekly, date(2018, 10, 30), date(2018, 10, 24), date(2018, 10, 31)},
+		{"weekly start day", Calendar{WeekStart: time.Wednesday}, Weekly, date(2018, 10, 31), date(2018, 10, 31), date(2018, 11, 7)},
+		{"monthly", Calendar{}, Monthly, date(2018, 10, 31), date(2018, 10, 1), date(2018, 11, 1)},
+		{"quarterly", Calendar{}, Quarterly, date(2018, 11, 15), date(2018, 10, 1), date(2019, 1, 1)},
+		{"yearly", Calendar{}, Yearly, date(2018, 11, 15), date(2018, 1, 1), date(2019, 1, 1)},
+		{"daily across DST", Calendar{}, Daily, time.Date(2018, 10, 28, 12, 0, 0, 0, berlin), time.Date(2018, 10, 28, 0, 0, 0, 0, berlin), time.Date(2018, 10, 29, 0, 0, 0, 0, berlin)},
+		{"weekly across DST", Calendar{WeekStart: time.Monday}, Weekly, time.Date(2018, 10, 28, 12, 0, 0, 0, berlin), time.Date(2018, 10, 22, 0, 0, 0, 0, berlin), time.Date(2018, 10, 29, 0, 0, 0, 0, berlin)},
+		{"float offset", Calendar{}, Daily, time.Date(2018, 10, 31, 1, 0, 0, 0, india), time.Date(2018, 10, 31, 0, 0, 0, 0, india), time.Date(2018, 11, 1, 0, 0, 0, 0, india)},
+	}
+
+	for _, test := range tests {
+		p := test.calendar.Of(test.dataRange, test.day)
+		if !p.Start.Equal(test.start) || !p.End.Equal(test.end) {
+			t.Errorf("%s: expect %v - %v, got %v - %v", test.name, test.start, test.end, p.Start, p.End)
+		}
+		if p.Start.Location() != test.day.Location() {
+			t.Errorf("%s: expect location %v, got %v", test.name, test.day.Location(), p.Start.Location())
+		}
+	}
+
+	// Midnight to midnight, not 24 hours
+	day := Calendar{}.Of(Daily, time.Date(2018, 10, 28, 12, 0, 0, 0, berlin))
+	if hours := day.End.Sub(day.Start).Hours(); hours != 25 {
+		t.Errorf("expect 25 hours on the day DST ends, got %v", hours)
+	}
+}
+
+func TestPreviousNext(t *testing.T) {
+	c := Calendar{WeekStart: time.Monday}
+	october := c.Of(Monthly, date(2018, 10, 15))
+
+	tests := []struct {
+		name  string
+		got   Period
+		start time.Time
+		end   time.Time
+	}{
+		{"previous of now", c.Previous(Monthly, time.Date(2018, 11, 1, 9, 0, 0, 0, time.UTC)), date(2018, 10, 1), date(2018, 11, 1)},
+		{"previous week of now", c.Previous(Weekly, date(2018, 11, 4)), date(2018, 10, 22), date(2018, 10, 29)},
+		{"previous", october.Previous(), date(2018, 9, 1), date(2018, 10, 1)},
+		{"next", october.Next(), date(2018, 11, 1), date(2018, 12, 1)},
+		{"next across the year", c.Of(Quarterly, date(2018, 11, 15)).Next(), date(2019, 1, 1), date(2019, 4, 1)},
+		{"year ago", october.YearAgo(), date(2017, 10, 1), date(2017, 11, 1)},
+		{"year ago of a leap day", c.Of(Daily, date(2016, 2, 29)).YearAgo(), date(2015, 3, 1), date(2015, 3, 2)},
+		{"previous interval", Period{Range: Monthly, Start: date(2018, 10, 5), End: date(2018, 10, 20), Calendar: c}.Previous(), date(2018, 9, 20), date(2018, 10, 5)},
+		{"year ago interval", Period{Range: Monthly, Start: date(2018, 10, 5), End: date(2018, 10, 20), Calendar: c}.YearAgo(), date(2017, 10, 5), date(2017, 10, 20)},
+	}
+
+	for _, test := range tests {
+		if !test.got.Start.Equal(test.start) || !test.got.End.Equal(test.end) {
+			t.Errorf("%s: expect %v - %v, got %v - %v", test.name, test.start, test.end, test.got.Start, test.got.End)
+		}
+	}
+}
+
+func TestISOWeek(t *testing.T) {
+	c := Calendar{WeekStart: time.Monday, ISOWeek: true}
+	tests := []struct {
+		day   time.Time
+		label string
+		year  int
+		dates string
+	}{
+		{date(2018, 10, 31), "2018-W44", 2018, "2018-W44 (2018/10/29 - 2018/11/05)"},
+		// Week 1 of 2019 starts in 2018
+		{date(2018, 12, 31), "2019-W01", 2019, "2019-W01 (2018/12/31 - 2019/01/07)"},
+		{date(2019, 1, 6), "2019-W01", 2019, "2019-W01 (2018/12/31 - 2019/01/07)"},
+		// Week 53 of 2020 ends in 2021
+		{date(2021, 1, 3), "2020-W53", 2020, "2020-W53 (2020/12/28 - 2021/01/04)"},
+		{date(2021, 1, 4), "2021-W01", 2021, "2021-W01 (2021/01/04 - 2021/01/11)"},
+	}
+
+	for _, test := range tests {
+		p := c.Of(Weekly, test.day)
+		if p.Label() != test.label || p.Year() != test.year || p.Dates() != test.dates {
+			t.Errorf("%v: expect %s in %d (%s), got %s in %d (%s)", test.day, test.label, test.year, test.dates, p.Label(), p.Year(), p.Dates())
+		}
+	}
+
+	// Weeks which do not start on Monday keep their dates
+	if label := (Calendar{ISOWeek: true}).Of(Weekly, date(2018, 10, 31)).Label(); label != "2018-1028-1104" {
+		t.Errorf("expect 2018-1028-1104, got %s", label)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	c := Calendar{}
+	day := date(2018, 10, 31)
+	tests := []struct {
+		dataRange string
+		label     string
+		dates     string
+	}{
+		{Daily, "2018-10-31", "2018/10/31"},
+		{Weekly, "2018-1028-1104", "2018/10/28 - 2018/11/04"},
+		{Monthly, "2018-10", "2018/10"},
+		{Quarterly, "2018-Q4", "2018 Q4"},
+		{Yearly, "2018", "2018"},
+	}
+
+	for _, test := range tests {
+		p := c.Of(test.dataRange, day)
+		if p.Label() != test.label || p.Dates() != test.dates {
+			t.Errorf("%s: expect %s (%s), got %s (%s)", test.dataRange, test.label, test.dates, p.Label(), p.Dates())
+		}
+	}
+
+	// A regular week across the year keeps the short form
+	if label := c.Of(Weekly, date(2018, 12, 31)).Label(); label != "2018-1230-0106" {
+		t.Errorf("expect 2018-1230-0106, got %s", label)
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	c := Calendar{}
+	tests := []struct {
+		p      Period
+		names  []string
+		labels []string
+	}{
+		{c.Of(Monthly, date(2018, 10, 31)), []string{"previous month", "same month last year"}, []string{"2018-09", "2017-10"}},
+		{c.Of(Weekly, date(2018, 10, 31)), []string{"previous week"}, []string{"2018-1021-1028"}},
+		{c.Of(Quarterly, date(2018, 1, 31)), []string{"previous quarter"}, []string{"2017-Q4"}},
+		{Period{Range: Monthly, Start: date(2018, 10, 5), End: date(2018, 10, 20), Calendar: c}, []string{"previous month", "same month last year"}, []string{"2018-0920-1005", "2017-1005-1020"}},
+	}
+
+	for _, test := range tests {
+		comparisons := test.p.Comparisons()
+		if len(comparisons) != len(test.names) {
+			t.Fatalf("%s: expect %d comparisons, got %+v", test.p.Label(), len(test.names), comparisons)
+		}
+		for i, comparison := range comparisons {
+			if comparison.Name != test.names[i] || comparison.Period.Label() != test.labels[i] {
+				t.Errorf("%s: expect %s %s, got %s %s", test.p.Label(), test.names[i], test.labels[i], comparison.Name, comparison.Period.Label())
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/appengine/taskqueue"
+
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+)
+
+const (
+	// The report task of a period first runs after this delay, then retries
+	// until the export tasks of its stuff job are done
+	BackfillReportDelay = 10 * time.Minute
+	// Periods one backfill may enqueue, e.g. five years of monthly reports
+	MaxBackfillPeriods = 60
+)
+
+/************************************************
+
+Backfill
+
+************************************************/
+
+// Backfill enqueues the stuff job and the report job of every period of the
+// range from the period of startTime up to endTime, the previous period at
+// the latest. A report waits for the export tasks of its period. Files and
+// reports already in the bucket are kept, backfilled reports are not mailed.
+func (es *ExportService) Backfill(ctx context.Context, dataRange, startTime, endTime string) (periods int, err error) {
+	if err = es.SetDataRange(dataRange, startTime, ""); err != nil {
+		return
+	}
+
+	end, err := es.parseTime(endTime)
+	if err != nil {
+		return
+	}
+
+	// The current period is not complete yet
+	last := es.conf.Calendar().Previous(es.Period.Range, time.Now().In(es.client.Location()))
+	if end.After(last.End) {
+		end = last.End
+	}
+
+	var backfill []period.Period
+	for p := es.Period; p.Start.Before(end); p = p.Next() {
+		if len(backfill) == MaxBackfillPeriods {
+			return 0, fmt.Errorf("more than %d %s periods from %s to %s, split the backfill", MaxBackfillPeriods, es.Period.Range, startTime, endTime)
+		}
+		backfill = append(backfill, p)
+	}
+
+	for _, p := range backfill {
+		start := p.Start.Format("2006-01-02")
+
+		stuffTask := taskqueue.NewPOSTTask(
+			"/cron/"+p.Range+"-report-stuff",
+			map[string][]string{
+				"start":        {start},
+				"skipExisting": {"true"},
+			},
+		)
+		if _, err := taskqueue.Add(ctx, stuffTask, ""); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		reportTask := taskqueue.NewPOSTTask(
+			"/cron/"+p.Range+"-report",
+			map[string][]string{
+				"start":        {start},
+				"skipExisting": {"true"},
+				"sendMail":     {"false"},
+				"waitStuff":    {"true"},
+			},
+		)
+		reportTask.Delay = BackfillReportDelay
+		reportTask.RetryOptions = &taskqueue.RetryOptions{
+			AgeLimit:   24 * time.Hour,
+			MinBackoff: 5 * time.Minute,
+			MaxBackoff: time.Hour,
+		}
+		if _, err := taskqueue.Add(ctx, reportTask, ""); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Printf("Backfill %s period from %s", p.Range, start)
+		periods++
+	}
+
+	return
+}
@@ -2,46 +2,37 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"google.golang.org/appengine/taskqueue"
 
 	"stackdriver-monitoring-simple-reporter/pkg/gcp"
 	"stackdriver-monitoring-simple-reporter/pkg/gcp/stackdriver"
 	"stackdriver-monitoring-simple-reporter/pkg/metric_exporter"
+	"stackdriver-monitoring-simple-reporter/pkg/period"
 	"stackdriver-monitoring-simple-reporter/pkg/utils"
 )
 
-const (
-	DataRangeWeekly  = "weekly"
-	DataRangeMonthly = "monthly"
-)
-
-var monitoringMetrics = []string{
-	"compute.googleapis.com/instance/cpu/usage_time",
-}
-
-// sampled every 60 seconds
-//
-// * buffered
-// * cached
-// * free
-// * used
-//
-var monitoringAgentMetrics = []string{
-	"agent.googleapis.com/memory/bytes_used",
-}
-
 /************************************************
 
 Initialize and Configuraion
 
 ************************************************/
 
+// SkipExisting leaves out the projects whose files or report of the period
+// are already in the bucket, SendMail mails the reports. WaitStuff holds the
+// reports of the projects whose export tasks are still running.
 type ExportService struct {
-	conf      utils.Conf
-	client    stackdriver.MonitoringClient
-	DataRange string
+	conf         utils.Conf
+	client       stackdriver.MonitoringClient
+	Period       period.Period
+	SkipExisting bool
+	SendMail     bool
+	WaitStuff    bool
 }
 
 func NewExportService(ctx context.Context) *ExportService {
@@ -57,31 +48,97 @@ func (es *ExportService) init(ctx context.Context) *ExportService {
 	es.conf.LoadConfig()
 
 	es.client = stackdriver.MonitoringClient{}
-	es.client.SetTimezone(es.conf.Timezone)
+	es.client.SetLocation(es.conf.Location())
+	es.client.SetPageSize(es.conf.PageSize)
 	es.client.SetContext(ctx)
 
+	es.SendMail = true
+
 	return es
 }
 
-func (es *ExportService) SetWeekly() {
-	es.client.SetWeekly()
-	es.DataRange = DataRangeWeekly
+// SetDataRange sets the period to export or report. Without startTime it is
+// the previous period of the range, with startTime only the period of that
+// day, and with both an explicit interval, e.g. the one of an export task.
+// Times are RFC 3339 or local dates like 2018-10-28.
+func (es *ExportService) SetDataRange(dataRange, startTime, endTime string) error {
+	if dataRange == "" {
+		dataRange = period.Weekly
+	}
+	if !period.Valid(dataRange) {
+		return fmt.Errorf("unknown data range %q, expect one of %v", dataRange, period.Ranges)
+	}
+
+	if startTime == "" {
+		if endTime != "" {
+			return fmt.Errorf("end time %s needs a start time", endTime)
+		}
+
+		es.setPeriod(es.conf.Calendar().Previous(dataRange, time.Now().In(es.client.Location())))
+		return nil
+	}
+
+	start, err := es.parseTime(startTime)
+	if err != nil {
+		return err
+	}
+
+	if endTime == "" {
+		es.setPeriod(es.conf.Calendar().Of(dataRange, start.In(es.client.Location())))
+		return nil
+	}
+
+	end, err := es.parseTime(endTime)
+	if err != nil {
+		return err
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end time %s is not after start time %s", endTime, startTime)
+	}
+
+	p := period.Period{
+		Range:    dataRange,
+		Start:    start.In(es.client.Location()),
+		End:      end.In(es.client.Location()),
+		Calendar: es.conf.Calendar(),
+	}
+	if step := es.longestStep(p); end.Sub(start) < step {
+		return fmt.Errorf("interval from %s to %s is shorter than the %s alignment period of %s", startTime, endTime, step, dataRange)
+	}
+
+	es.setPeriod(p)
+	return nil
 }
 
-func (es *ExportService) SetMonthly() {
-	es.client.SetMonthly()
-	es.DataRange = DataRangeMonthly
+// The longest alignment period of the catalog in the range of p, an interval
+// needs at least one point of every metric
+func (es *ExportService) longestStep(p period.Period) (longest time.Duration) {
+	for _, metric := range es.conf.Metrics {
+		step, err := time.ParseDuration(metricAggregation(metric, p).AlignmentPeriod)
+		if err == nil && step > longest {
+			longest = step
+		}
+	}
+
+	return
 }
 
-func (es *ExportService) SetDataRange(dataRange string) {
-	switch dataRange {
-	case DataRangeMonthly:
-		es.client.SetMonthly()
-		es.DataRange = DataRangeMonthly
-	default:
-		es.client.SetWeekly()
-		es.DataRange = DataRangeWeekly
+func (es *ExportService) setPeriod(p period.Period) {
+	es.Period = p
+	es.client.SetInterval(p.Start, p.End)
+}
+
+func (es *ExportService) parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, es.client.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expect RFC 3339 or YYYY-MM-DD", value)
 	}
+
+	return t, nil
 }
 
 /************************************************
@@ -91,89 +148,213 @@ Process
 ************************************************/
 
 func (es *ExportService) Do(ctx context.Context) {
-	projectIDs := gcp.GetProjects(ctx)
+	projectIDs := gcp.GetProjects(ctx, es.conf.Projects)
 
 	for prjIdx := range projectIDs {
 		projectID := projectIDs[prjIdx]
 
+		if es.SkipExisting && es.hasStuff(projectID) {
+			log.Printf("Skip project ID %s, its files are already exported", projectID)
+			continue
+		}
+
 		log.Printf("Query metrics in project ID: %s", projectID)
 
-		// GCP metrics
-		es.exportInstanceGCPMetrics(ctx, projectID)
+		resources, listStats := es.discoverResources(ctx, projectID)
+
+		run := strconv.FormatInt(time.Now().UnixNano(), 10)
+		tasks := es.exportInstanceMetrics(ctx, projectID, run, resources)
+		es.newMetricExporter().ExportTasksEnqueued(es.Period, projectID, run, tasks)
 
-		// Agent metrics
-		es.exportInstanceAgentMetrics(ctx, projectID)
+		es.exportListStats(projectID, listStats)
 	}
 }
 
-/************************************************
+func (es *ExportService) hasStuff(projectID string) bool {
+	return es.newMetricExporter().HasStuff(es.Period, projectID)
+}
 
-Export GCP and Agent Metrics
+// Record how many pages and series the instance discovery read
+func (es *ExportService) exportListStats(projectID string, listStats []stackdriver.ListStats) {
+	es.newMetricExporter().ExportListStats(es.Period, projectID, listStats)
+}
 
-************************************************/
+// Find the resources of every resource type in the catalog. GCE instances
+// are listed through the Compute Engine API as well, which also knows the
+// stopped ones, selected and saved as the inventory.
+func (es *ExportService) discoverResources(ctx context.Context, projectID string) (resources map[string][]stackdriver.MonitoredResource, listStats []stackdriver.ListStats) {
+	resources = make(map[string][]stackdriver.MonitoredResource)
 
-func (es *ExportService) exportInstanceGCPMetrics(ctx context.Context, projectID string) {
-	for mIdx := range monitoringMetrics {
-		metric := monitoringMetrics[mIdx]
-
-		instanceNames := es.client.GetInstanceNames(projectID, metric)
-
-		for instIdx := range instanceNames {
-			instanceName := instanceNames[instIdx]
-
-			filter := stackdriver.MakeInstanceFilter(metric, instanceName)
-
-			t := taskqueue.NewPOSTTask(
-				"/export",
-				map[string][]string{
-					"projectID":         {projectID},
-					"metric":            {metric},
-					"aligner":           {stackdriver.AggregationPerSeriesAlignerRate},
-					"filter":            {filter},
-					"instanceName":      {instanceName},
-					"intervalStartTime": {es.client.IntervalStartTime},
-					"intervalEndTime":   {es.client.IntervalEndTime},
-					"dataRange":         {es.DataRange},
-				},
-			)
-			if _, err := taskqueue.Add(ctx, t, ""); err != nil {
-				log.Fatal(err.Error())
+	for _, resource := range catalogResources(es.conf.Metrics) {
+		found, stats := es.client.GetResources(projectID, resource)
+		listStats = append(listStats, stats)
+
+		if resource == stackdriver.ResourceGCEInstance {
+			instances, err := es.getInstances(ctx, projectID)
+			if err != nil {
+				log.Printf("discoverResources: %v, %s falls back to the instances known to Monitoring", err, projectID)
 			}
+			instances = es.selectInstances(projectID, mergeInstances(instances, found, err == nil))
+			es.exportInventory(projectID, instances)
+
+			found = instanceResources(instances)
+		}
+
+		resources[resource] = found
+	}
+
+	return
+}
+
+func (es *ExportService) getInstances(ctx context.Context, projectID string) ([]gcp.Instance, error) {
+	computeClient, err := gcp.NewComputeClient(ctx, es.conf.ComputeEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeClient.GetInstances(ctx, projectID)
+}
+
+func (es *ExportService) exportInventory(projectID string, instances []gcp.Instance) {
+	es.newMetricExporter().ExportInventory(es.Period, projectID, instances)
+}
+
+// Instances deleted during the period are only known to Monitoring, their
+// labels are the user labels of their series. Without the listing of the
+// Compute Engine API their status is unknown.
+func mergeInstances(instances []gcp.Instance, found []stackdriver.MonitoredResource, listed bool) []gcp.Instance {
+	status := gcp.InstanceStatusUnknown
+	if listed {
+		status = gcp.InstanceStatusDeleted
+	}
+
+	seen := make(map[string]bool)
+	for _, instance := range instances {
+		seen[instance.Key()] = true
+	}
+
+	for _, r := range found {
+		if seen[r.Key()] {
+			continue
+		}
+		seen[r.Key()] = true
+
+		instances = append(instances, gcp.Instance{
+			Name:   r.Name,
+			ID:     r.ID,
+			Zone:   r.Zone,
+			Status: status,
+			Labels: r.Labels,
+		})
+	}
+
+	return instances
+}
+
+// Drop the instances the selection rules of the project leave out
+func (es *ExportService) selectInstances(projectID string, instances []gcp.Instance) []gcp.Instance {
+	selection, ok := es.conf.Selections.Of(projectID)
+	if !ok {
+		return instances
+	}
+
+	var selected []gcp.Instance
+	for _, instance := range instances {
+		if selection.Match(instance.Name, instance.Zone, instance.Labels) {
+			selected = append(selected, instance)
+		}
+	}
+
+	log.Printf("selectInstances: %d of %d instance(s) selected", len(selected), len(instances))
+
+	return selected
+}
+
+func instanceResources(instances []gcp.Instance) []stackdriver.MonitoredResource {
+	resources := make([]stackdriver.MonitoredResource, len(instances))
+	for i, instance := range instances {
+		resources[i] = stackdriver.MonitoredResource{
+			Type: stackdriver.ResourceGCEInstance,
+			ID:   instance.ID,
+			Zone: instance.Zone,
+			Name: instance.Name,
 		}
 	}
+
+	return resources
 }
 
-func (es *ExportService) exportInstanceAgentMetrics(ctx context.Context, projectID string) {
-	// We use the common metric to get the instance name, we can't query with agent metric
-	instanceNames := es.client.GetInstanceNames(projectID, monitoringMetrics[0])
+/************************************************
 
-	for mIdx := range monitoringAgentMetrics {
-		metric := monitoringAgentMetrics[mIdx]
+Export Instance Metrics
 
-		for instIdx := range instanceNames {
-			instanceName := instanceNames[instIdx]
+************************************************/
 
-			// Currently only support instance memory
-			filter := stackdriver.MakeAgentMemoryFilter(metric, instanceName)
+// Enqueue one export task for every resource and metric in the catalog, the
+// tasks are numbered within the run of the stuff job
+func (es *ExportService) exportInstanceMetrics(ctx context.Context, projectID, run string, resources map[string][]stackdriver.MonitoredResource) (tasks int) {
+	for _, resource := range catalogResources(es.conf.Metrics) {
+		for mIdx := range es.conf.Metrics {
+			metric := es.conf.Metrics[mIdx]
+			if metric.Resource != resource {
+				continue
+			}
 
-			t := taskqueue.NewPOSTTask(
-				"/export",
-				map[string][]string{
-					"projectID":         {projectID},
-					"metric":            {metric},
-					"aligner":           {stackdriver.AggregationPerSeriesAlignerMean},
-					"filter":            {filter},
-					"instanceName":      {instanceName},
-					"intervalStartTime": {es.client.IntervalStartTime},
-					"intervalEndTime":   {es.client.IntervalEndTime},
-					"dataRange":         {es.DataRange},
-				},
-			)
-			if _, err := taskqueue.Add(ctx, t, ""); err != nil {
-				log.Fatal(err.Error())
+			for _, r := range resources[resource] {
+				filter := stackdriver.MakeFilter(metric.Filter, metric.Type, r)
+
+				t := taskqueue.NewPOSTTask(
+					"/export",
+					map[string][]string{
+						"projectID":         {projectID},
+						"metric":            {metric.Name},
+						"filter":            {filter},
+						"instanceName":      {r.Key()},
+						"intervalStartTime": {es.client.IntervalStartTime},
+						"intervalEndTime":   {es.client.IntervalEndTime},
+						"dataRange":         {es.Period.Range},
+						"run":               {run},
+						"task":              {strconv.Itoa(tasks)},
+					},
+				)
+				if _, err := taskqueue.Add(ctx, t, ""); err != nil {
+					log.Fatal(err.Error())
+				}
+				tasks++
 			}
 		}
 	}
+
+	return
+}
+
+// Resource types in the order they first appear in the catalog
+func catalogResources(metrics []utils.MetricConf) (resources []string) {
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		if seen[metric.Resource] {
+			continue
+		}
+		seen[metric.Resource] = true
+
+		if _, ok := stackdriver.Discoveries[metric.Resource]; !ok {
+			log.Printf("Metric %s: resource %s is not supported", metric.Name, metric.Resource)
+			continue
+		}
+		resources = append(resources, metric.Resource)
+	}
+
+	return
+}
+
+func metricAggregation(metric utils.MetricConf, p period.Period) stackdriver.Aggregation {
+	return stackdriver.Aggregation{
+		Aligner:         metric.Aligner,
+		Reducer:         metric.Reducer,
+		GroupBy:         metric.GroupBy,
+		AlignmentPeriod: metric.AlignmentPeriodOf(p.Range, p.AlignmentPeriod()),
+		ExtraAligners:   metric.Aligners,
+	}
 }
 
 /************************************************
@@ -182,23 +363,122 @@ Export Stuff
 
 ************************************************/
 
-func (es *ExportService) ExportStuff(projectID, metric, aligner, filter, instanceName string) {
-	switch es.DataRange {
-	case DataRangeMonthly:
-		es.ExportMonthlyStuff(
-			projectID,
-			metric,
-			aligner,
-			filter,
-			instanceName,
-		)
-	default:
-		es.ExportWeeklyStuff(
-			projectID,
-			metric,
-			aligner,
-			filter,
-			instanceName,
-		)
+// ExportStuff returns the list stats of the export, by metric name
+func (es *ExportService) ExportStuff(projectID, metricName, filter, instanceName string) (stats stackdriver.ListStats) {
+	metric, ok := es.conf.Metric(metricName)
+	if !ok {
+		log.Printf("ExportStuff: metric %s is not in the catalog", metricName)
+		return
 	}
+
+	series, stats := es.client.RetrieveMetricPoints(projectID, metric.Type, metricAggregation(metric, es.Period), filter)
+	stats.Metric = metric.Name
+
+	if len(series) == 0 {
+		return
+	}
+
+	metricExporter := es.newMetricExporter()
+	metricExporter.ExportMetrics(es.Period, projectID, metric, instanceName, series)
+	metricExporter.ExportMetricsChart(es.Period, projectID, metric, instanceName, series)
+
+	return
+}
+
+// Tasks enqueued before runs were recorded have no run
+func (es *ExportService) ExportTaskDone(projectID, run, task string, stats stackdriver.ListStats) {
+	if run == "" {
+		return
+	}
+
+	es.newMetricExporter().ExportTaskDone(es.Period, projectID, run, task, stats)
+}
+
+/************************************************
+
+Export Report
+
+************************************************/
+
+// The report compares a metric with the CSVs of earlier periods, those the
+// bucket does not have yet are queried from Monitoring once for the resources
+// of the report and saved in its own folder. Metrics split by FolderBy or
+// NameBy only use what the bucket has. The list stats of the queries are
+// returned by metric name.
+func (es *ExportService) exportPriorStuff(projectID string) (listStats []stackdriver.ListStats) {
+	metricExporter := es.newMetricExporter()
+
+	for _, comparison := range es.Period.Comparisons() {
+		prior := comparison.Period
+		client := es.client
+		client.SetInterval(prior.Start, prior.End)
+
+		for _, resource := range catalogResources(es.conf.Metrics) {
+			var compared []utils.MetricConf
+			for _, metric := range es.conf.Metrics {
+				if metric.Resource == resource && metric.Compare && metric.FolderBy == "" && metric.NameBy == "" {
+					compared = append(compared, metric)
+				}
+			}
+			if len(compared) == 0 {
+				continue
+			}
+
+			resources, _ := client.GetResources(projectID, resource)
+			for _, metric := range compared {
+				for _, r := range resources {
+					instanceName := r.Key()
+					if !metricExporter.HasMetrics(es.Period, projectID, metric, instanceName) ||
+						metricExporter.HasPriorMetrics(es.Period, prior, projectID, metric, instanceName) {
+						continue
+					}
+
+					series, stats := client.RetrieveMetricPoints(projectID, metric.Type, metricAggregation(metric, prior), stackdriver.MakeFilter(metric.Filter, metric.Type, r))
+					stats.Metric = metric.Name
+					stats.Source = stackdriver.ListSourceComparison
+					listStats = stackdriver.AddListStats(listStats, stats)
+					if len(series) == 0 {
+						continue
+					}
+
+					log.Printf("Export %s of %s for the %s comparison", metric.Name, instanceName, comparison.Name)
+					metricExporter.ExportPriorMetrics(es.Period, prior, projectID, metric, instanceName, series)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// ExportReport fails with the projects left waiting for their export tasks
+func (es *ExportService) ExportReport(ctx context.Context) error {
+	metricExporter := es.newMetricExporter()
+
+	projectIDs := gcp.GetProjects(ctx, es.conf.Projects)
+
+	var waiting []string
+	for prjIdx := range projectIDs {
+		projectID := projectIDs[prjIdx]
+		if es.SkipExisting && metricExporter.HasReport(projectID, es.Period) {
+			log.Printf("Skip project ID %s, its report is already generated", projectID)
+			continue
+		}
+		if es.WaitStuff && (!metricExporter.HasStuff(es.Period, projectID) || !metricExporter.HasAllStuff(es.Period, projectID)) {
+			log.Printf("Wait for project ID %s, its export tasks are still running", projectID)
+			waiting = append(waiting, projectID)
+			continue
+		}
+
+		metricExporter.ExportReport(projectID, es.Period, es.exportPriorStuff(projectID))
+		if es.SendMail {
+			metricExporter.SendReport(ctx, projectID, es.conf.MailReceiver, es.Period)
+		}
+	}
+
+	if len(waiting) > 0 {
+		return fmt.Errorf("export tasks of %s are still running", strings.Join(waiting, ", "))
+	}
+
+	return nil
 }
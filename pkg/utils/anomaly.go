@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"log"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+)
+
+// AnomalyConf tunes the anomaly marks of the charts and the Anomalies
+// section of the PDF. Windows are numbers of aligned points, thresholds are
+// robust z-scores, lower ones flag more points.
+type AnomalyConf struct {
+	Disabled       bool    `yaml:"disabled"`
+	Window         int     `yaml:"window"`
+	Threshold      float64 `yaml:"threshold"`
+	ShiftWindow    int     `yaml:"shiftWindow"`
+	ShiftThreshold float64 `yaml:"shiftThreshold"`
+}
+
+func (c *Conf) loadAnomalies() {
+	a := &c.Anomalies
+	if a.Window == 0 {
+		a.Window = 24
+	}
+	if a.Threshold == 0 {
+		a.Threshold = 4
+	}
+	if a.ShiftWindow == 0 {
+		a.ShiftWindow = 12
+	}
+	if a.ShiftThreshold == 0 {
+		a.ShiftThreshold = 4
+	}
+
+	if a.Window < 3 || a.ShiftWindow < 3 || a.Threshold <= 0 || a.ShiftThreshold <= 0 {
+		log.Fatalf("Anomalies: windows need 3 points at least and thresholds must be positive")
+	}
+}
+
+func (a AnomalyConf) Options() analysis.AnomalyOptions {
+	return analysis.AnomalyOptions{
+		Window:         a.Window,
+		Threshold:      a.Threshold,
+		ShiftWindow:    a.ShiftWindow,
+		ShiftThreshold: a.ShiftThreshold,
+	}
+}
@@ -1,16 +1,343 @@
 package utils
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
+
+	"stackdriver-monitoring-simple-reporter/pkg/period"
 )
 
+// Conf is the content of config.yaml
 type Conf struct {
-	Timezone     int    `yaml:"timezone"`
+	// IANA name like Europe/Berlin or an hour offset like 8 or 5.5, UTC by default
+	Timezone string `yaml:"timezone"`
+	// First day of the week, Sunday by default
+	WeekStart string `yaml:"weekStart"`
+	// Name weekly reports by ISO week number
+	ISOWeek      bool   `yaml:"isoWeek"`
 	Destination  string `yaml:"destination"`
 	MailReceiver string `yaml:"mailReceiver"`
+	PageSize     int64  `yaml:"pageSize"`
+	// Reported projects
+	Projects ProjectScope `yaml:"projects"`
+	// Overrides the Compute Engine API base path
+	ComputeEndpoint string `yaml:"computeEndpoint"`
+	// Pick the reported GCE instances of each project
+	Selections Selections `yaml:"selections"`
+	// Resize recommendations
+	Rightsizing RightsizingConf `yaml:"rightsizing"`
+	// Tunes the anomaly detection
+	Anomalies AnomalyConf `yaml:"anomalies"`
+	// Capacity projections
+	Forecast ForecastConf `yaml:"forecast"`
+	// Usage by weekday and hour
+	Heatmaps HeatmapConf `yaml:"heatmaps"`
+	// Overview of the busiest instances
+	Ranking RankingConf `yaml:"ranking"`
+	// Estimates from a pricing file
+	Cost     CostConf     `yaml:"cost"`
+	Metrics  []MetricConf `yaml:"metrics"`
+	location *time.Location
+	calendar period.Calendar
+}
+
+// MetricConf is one entry of the metric catalog
+type MetricConf struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Monitored resource type the filter selects, gce_instance by default
+	Resource string `yaml:"resource"`
+	// Template which gets {{.Metric}}, {{.InstanceName}}, {{.InstanceID}} and {{.Zone}}
+	Filter  string `yaml:"filter"`
+	Aligner string `yaml:"aligner"`
+	// Retrieved next to Aligner as extra CSV columns, with both ALIGN_MIN and
+	// ALIGN_MAX the chart shades the band between them
+	Aligners        []string `yaml:"aligners"`
+	Reducer         string   `yaml:"reducer"`
+	GroupBy         []string `yaml:"groupBy"`
+	AlignmentPeriod string   `yaml:"alignmentPeriod"`
+	// Alignment period per data range, e.g. weekly: 300s. Daily, quarterly and
+	// yearly ranges otherwise have their own.
+	AlignmentPeriods map[string]string `yaml:"alignmentPeriods"`
+	// Picks the chart value formatter
+	Unit  string `yaml:"unit"`
+	Title string `yaml:"title"`
+	// Metrics of a group share a PDF page
+	Group string `yaml:"group"`
+	// A series whose trend ends above it is called out in the PDF
+	WarningLevel float64 `yaml:"warningLevel"`
+	// Split the series into one chart per label value, in a sub folder per
+	// FolderBy value
+	FolderBy string `yaml:"folderBy"`
+	NameBy   string `yaml:"nameBy"`
+	// Show the change of mean and p95 versus earlier periods in the PDF
+	Compare bool `yaml:"compare"`
+	// Value of 100%, or CapacityOf takes it from the monitored resource. The
+	// series of a metric with either one are projected.
+	Capacity   float64 `yaml:"capacity"`
+	CapacityOf string  `yaml:"capacityOf"`
+}
+
+// Used when the config has no metrics
+var defaultMetrics = []MetricConf{
+	{
+		Name:            "cpu_usage_time",
+		Type:            "compute.googleapis.com/instance/cpu/usage_time",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitCPU,
+		Title:           "CPU Usage Time",
+		Group:           "instance",
+		Compare:         true,
+	},
+	// sampled every 60 seconds
+	//
+	// * buffered
+	// * cached
+	// * free
+	// * used
+	//
+	{
+		Name:            "memory_bytes_used",
+		Type:            "agent.googleapis.com/memory/bytes_used",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}" AND metric.labels.state="used"`,
+		Aligner:         "ALIGN_MEAN",
+		Aligners:        []string{"ALIGN_MIN", "ALIGN_MAX", "ALIGN_PERCENTILE_95"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytes,
+		Title:           "Memory Bytes Used",
+		Group:           "instance",
+		Compare:         true,
+		CapacityOf:      CapacityMachineMemory,
+	},
+	// One series per disk
+	{
+		Name:            "disk_read_bytes_count",
+		Type:            "compute.googleapis.com/instance/disk/read_bytes_count",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytesPerSecond,
+		Title:           "Disk Read Bytes",
+		Group:           "disk",
+	},
+	{
+		Name:            "disk_write_bytes_count",
+		Type:            "compute.googleapis.com/instance/disk/write_bytes_count",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytesPerSecond,
+		Title:           "Disk Write Bytes",
+		Group:           "disk",
+	},
+	{
+		Name:            "disk_read_ops_count",
+		Type:            "compute.googleapis.com/instance/disk/read_ops_count",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitIOPS,
+		Title:           "Disk Read Operations",
+		Group:           "disk",
+	},
+	{
+		Name:            "disk_write_ops_count",
+		Type:            "compute.googleapis.com/instance/disk/write_ops_count",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitIOPS,
+		Title:           "Disk Write Operations",
+		Group:           "disk",
+	},
+	// Load balanced and direct traffic are summed up
+	{
+		Name:            "network_received_bytes_count",
+		Type:            "compute.googleapis.com/instance/network/received_bytes_count",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.instance_id"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytesPerSecond,
+		Title:           "Network Received Bytes",
+		Group:           "network",
+	},
+	{
+		Name:            "network_sent_bytes_count",
+		Type:            "compute.googleapis.com/instance/network/sent_bytes_count",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}"`,
+		Aligner:         "ALIGN_RATE",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.instance_id"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytesPerSecond,
+		Title:           "Network Sent Bytes",
+		Group:           "network",
+	},
+	// One series per device
+	{
+		Name:            "disk_percent_used",
+		Type:            "agent.googleapis.com/disk/percent_used",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}" AND metric.labels.state="used"`,
+		Aligner:         "ALIGN_MEAN",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitPercent,
+		Title:           "Filesystem Usage",
+		Group:           "filesystem",
+		WarningLevel:    80,
+		Capacity:        100,
+	},
+	{
+		Name:            "swap_percent_used",
+		Type:            "agent.googleapis.com/swap/percent_used",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.instance_id="{{.InstanceID}}" AND resource.labels.zone="{{.Zone}}" AND metric.labels.state="used"`,
+		Aligner:         "ALIGN_MEAN",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitPercent,
+		Title:           "Swap Usage",
+		Group:           "swap",
+	},
+	{
+		Name:            "cloudsql_cpu_utilization",
+		Type:            "cloudsql.googleapis.com/database/cpu/utilization",
+		Resource:        "cloudsql_database",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.database_id="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		Aligners:        []string{"ALIGN_MIN", "ALIGN_MAX", "ALIGN_PERCENTILE_95"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitRatio,
+		Title:           "CPU Utilization",
+		Group:           "cloudsql",
+	},
+	{
+		Name:            "cloudsql_memory_utilization",
+		Type:            "cloudsql.googleapis.com/database/memory/utilization",
+		Resource:        "cloudsql_database",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.database_id="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		Aligners:        []string{"ALIGN_MIN", "ALIGN_MAX", "ALIGN_PERCENTILE_95"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitRatio,
+		Title:           "Memory Utilization",
+		Group:           "cloudsql",
+		Capacity:        1,
+	},
+	{
+		Name:            "cloudsql_disk_utilization",
+		Type:            "cloudsql.googleapis.com/database/disk/utilization",
+		Resource:        "cloudsql_database",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.database_id="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		AlignmentPeriod: "3600s",
+		Unit:            UnitRatio,
+		Title:           "Disk Utilization",
+		Group:           "cloudsql",
+		Capacity:        1,
+	},
+	{
+		Name:            "cloudsql_connections",
+		Type:            "cloudsql.googleapis.com/database/network/connections",
+		Resource:        "cloudsql_database",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.database_id="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		AlignmentPeriod: "3600s",
+		Title:           "Connections",
+		Group:           "cloudsql",
+	},
+	// GKE workloads, one chart per workload in a folder per namespace
+	{
+		Name:            "gke_container_cpu_core_usage_time",
+		Type:            "kubernetes.io/container/cpu/core_usage_time",
+		Resource:        "k8s_container",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.cluster_name="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_RATE",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.namespace_name", "metadata.system_labels.top_level_controller_name"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitCores,
+		Title:           "Container CPU Usage",
+		Group:           "gke_workload",
+		FolderBy:        "resource.labels.namespace_name",
+		NameBy:          "metadata.system_labels.top_level_controller_name",
+	},
+	{
+		Name:            "gke_container_memory_used_bytes",
+		Type:            "kubernetes.io/container/memory/used_bytes",
+		Resource:        "k8s_container",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.cluster_name="{{.InstanceName}}" AND metric.labels.memory_type="non-evictable"`,
+		Aligner:         "ALIGN_MEAN",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.namespace_name", "metadata.system_labels.top_level_controller_name"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytes,
+		Title:           "Container Memory Used",
+		Group:           "gke_workload",
+		FolderBy:        "resource.labels.namespace_name",
+		NameBy:          "metadata.system_labels.top_level_controller_name",
+	},
+	// GKE cluster, allocatable on the nodes vs. requested by the containers
+	{
+		Name:            "gke_node_cpu_allocatable_cores",
+		Type:            "kubernetes.io/node/cpu/allocatable_cores",
+		Resource:        "k8s_node",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.cluster_name="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.cluster_name"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitCores,
+		Title:           "Node CPU Allocatable",
+		Group:           "gke_cluster_cpu",
+	},
+	{
+		Name:            "gke_container_cpu_request_cores",
+		Type:            "kubernetes.io/container/cpu/request_cores",
+		Resource:        "k8s_container",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.cluster_name="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.cluster_name"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitCores,
+		Title:           "Container CPU Requested",
+		Group:           "gke_cluster_cpu",
+	},
+	{
+		Name:            "gke_node_memory_allocatable_bytes",
+		Type:            "kubernetes.io/node/memory/allocatable_bytes",
+		Resource:        "k8s_node",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.cluster_name="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.cluster_name"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytes,
+		Title:           "Node Memory Allocatable",
+		Group:           "gke_cluster_memory",
+	},
+	{
+		Name:            "gke_container_memory_request_bytes",
+		Type:            "kubernetes.io/container/memory/request_bytes",
+		Resource:        "k8s_container",
+		Filter:          `metric.type="{{.Metric}}" AND resource.labels.cluster_name="{{.InstanceName}}"`,
+		Aligner:         "ALIGN_MEAN",
+		Reducer:         "REDUCE_SUM",
+		GroupBy:         []string{"resource.labels.cluster_name"},
+		AlignmentPeriod: "3600s",
+		Unit:            UnitBytes,
+		Title:           "Container Memory Requested",
+		Group:           "gke_cluster_memory",
+	},
 }
 
 func (c *Conf) LoadConfig() *Conf {
@@ -23,5 +350,169 @@ func (c *Conf) LoadConfig() *Conf {
 		log.Fatalf("Unmarshal: %v", err)
 	}
 
+	c.loadLocation()
+	c.loadCalendar()
+	c.loadMetrics()
+	c.loadSelections()
+	c.loadRightsizing()
+	c.loadAnomalies()
+	c.loadForecast()
+	c.loadHeatmaps()
+	c.loadRanking()
+	c.loadCost()
+
 	return c
 }
+
+func (c *Conf) loadLocation() {
+	c.location = time.UTC
+	if c.Timezone == "" {
+		return
+	}
+
+	// Offsets of older configs, e.g. timezone: 8
+	if hours, err := strconv.ParseFloat(c.Timezone, 64); err == nil {
+		c.location = time.FixedZone(fmt.Sprintf("UTC%+g", hours), int(hours*3600))
+		return
+	}
+
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		log.Fatalf("Invalid timezone %q: %v", c.Timezone, err)
+	}
+	c.location = location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func (c *Conf) loadCalendar() {
+	c.calendar = period.Calendar{WeekStart: time.Sunday, ISOWeek: c.ISOWeek}
+
+	if c.WeekStart != "" {
+		weekStart, ok := weekdays[strings.ToLower(c.WeekStart)]
+		if !ok {
+			log.Fatalf("Invalid weekStart %q, expect a weekday like monday", c.WeekStart)
+		}
+		c.calendar.WeekStart = weekStart
+	} else if c.ISOWeek {
+		c.calendar.WeekStart = time.Monday
+	}
+
+	if c.ISOWeek && c.calendar.WeekStart != time.Monday {
+		log.Fatalf("isoWeek needs weeks starting on monday, not %s", c.WeekStart)
+	}
+}
+
+// Calendar of the weekStart and isoWeek settings
+func (c Conf) Calendar() period.Calendar {
+	return c.calendar
+}
+
+// Location of the timezone setting
+func (c Conf) Location() *time.Location {
+	if c.location == nil {
+		return time.UTC
+	}
+
+	return c.location
+}
+
+func (c *Conf) loadMetrics() {
+	if len(c.Metrics) == 0 {
+		c.Metrics = defaultMetrics
+	}
+
+	// Names end up in file names like [instance_name][cpu_usage_time]
+	r := regexp.MustCompile(`^(\w|-)+$`)
+	names := make(map[string]bool)
+	for i := range c.Metrics {
+		m := &c.Metrics[i]
+
+		if m.Type == "" || m.Filter == "" || m.Aligner == "" {
+			log.Fatalf("Metric #%d needs type, filter and aligner", i)
+		}
+		if m.Name == "" {
+			m.Name = MetricName(m.Type)
+		}
+		if !r.MatchString(m.Name) {
+			log.Fatalf("Metric name %q may only contain letters, digits, '_' and '-'", m.Name)
+		}
+		if names[m.Name] {
+			log.Fatalf("Metric name %q is used twice", m.Name)
+		}
+		names[m.Name] = true
+		if m.Resource == "" {
+			m.Resource = "gce_instance"
+		}
+		if m.Title == "" {
+			m.Title = m.Name
+		}
+		if m.Group == "" {
+			m.Group = m.Name
+		}
+		for _, aligner := range m.Aligners {
+			if !strings.HasPrefix(aligner, "ALIGN_") || aligner == m.Aligner {
+				log.Fatalf("Metric %s: invalid extra aligner %q", m.Name, aligner)
+			}
+		}
+		if m.CapacityOf != "" && (m.CapacityOf != CapacityMachineMemory || m.Resource != "gce_instance") {
+			log.Fatalf("Metric %s: capacityOf %q is only supported as %s of gce_instance", m.Name, m.CapacityOf, CapacityMachineMemory)
+		}
+		for dataRange, alignmentPeriod := range m.AlignmentPeriods {
+			if !period.Valid(dataRange) {
+				log.Fatalf("Metric %s: unknown data range %q in alignment periods", m.Name, dataRange)
+			}
+			if step, err := time.ParseDuration(alignmentPeriod); err != nil || step < time.Minute {
+				log.Fatalf("Metric %s: invalid %s alignment period %q", m.Name, dataRange, alignmentPeriod)
+			}
+		}
+	}
+}
+
+// Projected tells whether the series of the metric are forecast
+func (m MetricConf) Projected() bool {
+	return m.Capacity > 0 || m.CapacityOf != ""
+}
+
+// Alignment period of the metric in a data range, the range default comes
+// before AlignmentPeriod
+func (m MetricConf) AlignmentPeriodOf(dataRange, rangeDefault string) string {
+	if alignmentPeriod, ok := m.AlignmentPeriods[dataRange]; ok {
+		return alignmentPeriod
+	}
+	if rangeDefault != "" {
+		return rangeDefault
+	}
+
+	return m.AlignmentPeriod
+}
+
+// Metric looks up a catalog entry by name
+func (c *Conf) Metric(name string) (MetricConf, bool) {
+	for _, m := range c.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+
+	return MetricConf{}, false
+}
+
+// e.g. compute.googleapis.com/instance/cpu/usage_time => cpu_usage_time
+func MetricName(metricType string) string {
+	name := strings.Replace(metricType, "compute.googleapis.com/instance/", "", -1)
+	name = strings.Replace(name, "agent.googleapis.com/", "", -1)
+	name = strings.Replace(name, "cloudsql.googleapis.com/database/", "cloudsql_", -1)
+	name = strings.Replace(name, "kubernetes.io/", "gke_", -1)
+	name = strings.Replace(name, "/", "_", -1)
+
+	return name
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CostConf adds cost estimates to the reports of Ranges, from the prices of
+// PricingFile. An hour whose CPU utilization is below IdleBelow is idle.
+type CostConf struct {
+	RangeSet    `yaml:",inline"`
+	PricingFile string  `yaml:"pricingFile"`
+	IdleBelow   float64 `yaml:"idleBelow"`
+	CPUMetric   string  `yaml:"cpuMetric"`
+	Pricing     Pricing `yaml:"-"`
+}
+
+// Pricing is the table of a pricing file. A price matches a machine type in
+// a region, or in every region without one. A price without machine type is
+// per vCPU and GB of memory, for machine types not in the table like custom
+// ones.
+type Pricing struct {
+	Currency string  `yaml:"currency"`
+	Prices   []Price `yaml:"prices"`
+}
+
+type Price struct {
+	MachineType    string  `yaml:"machineType"`
+	Region         string  `yaml:"region"`
+	Hourly         float64 `yaml:"hourly"`
+	VCPUHourly     float64 `yaml:"vcpuHourly"`
+	MemoryGBHourly float64 `yaml:"memoryGBHourly"`
+}
+
+var pricingCSVHeader = []string{"machine_type", "region", "hourly", "vcpu_hourly", "memory_gb_hourly"}
+
+func (c *Conf) loadCost() {
+	cost := &c.Cost
+	cost.loadRanges("Cost")
+	if cost.PricingFile == "" {
+		cost.PricingFile = "pricing.yaml"
+	}
+	if cost.IdleBelow == 0 {
+		cost.IdleBelow = 0.05
+	}
+	if cost.CPUMetric == "" {
+		cost.CPUMetric = "cpu_usage_time"
+	}
+
+	// Reports go without costs until there is a pricing file
+	if _, err := os.Stat(cost.PricingFile); os.IsNotExist(err) {
+		log.Printf("Cost: no pricing file %s, costs are not estimated", cost.PricingFile)
+		return
+	}
+	cost.Pricing = loadPricing(cost.PricingFile)
+	if cost.Pricing.Currency == "" {
+		cost.Pricing.Currency = "USD"
+	}
+}
+
+// YAML, or CSV with the columns of pricingCSVHeader
+func loadPricing(filename string) (pricing Pricing) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Cost: failed to read %s: %v", filename, err)
+	}
+
+	if !strings.EqualFold(filepath.Ext(filename), ".csv") {
+		if err := yaml.Unmarshal(data, &pricing); err != nil {
+			log.Fatalf("Cost: failed to parse %s: %v", filename, err)
+		}
+		return
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		log.Fatalf("Cost: failed to parse %s: %v", filename, err)
+	}
+
+	// Skip header
+	for i := 1; i < len(records); i++ {
+		if len(records[i]) < len(pricingCSVHeader) {
+			log.Fatalf("Cost: %s line %d: expect %s", filename, i+1, strings.Join(pricingCSVHeader, ","))
+		}
+
+		values := make([]float64, 3)
+		for j := range values {
+			if records[i][2+j] == "" {
+				continue
+			}
+			if values[j], err = strconv.ParseFloat(records[i][2+j], 64); err != nil {
+				log.Fatalf("Cost: %s line %d: invalid %s %q", filename, i+1, pricingCSVHeader[2+j], records[i][2+j])
+			}
+		}
+
+		pricing.Prices = append(pricing.Prices, Price{
+			MachineType:    records[i][0],
+			Region:         records[i][1],
+			Hourly:         values[0],
+			VCPUHourly:     values[1],
+			MemoryGBHourly: values[2],
+		})
+	}
+
+	return
+}
+
+// Enabled tells whether the reports of a data range have the cost estimates,
+// which needs a pricing file
+func (c CostConf) Enabled(dataRange string) bool {
+	return c.RangeSet.Enabled(dataRange) && len(c.Pricing.Prices) > 0
+}
+
+// HourlyOf finds the price of a machine type in a region: the price of the
+// machine type in the region, then in every region, then per vCPU and GB of
+// memory in the region and in every region.
+func (p Pricing) HourlyOf(machineType, region string, cpus, memoryMB int64) (float64, bool) {
+	for _, r := range []string{region, ""} {
+		for _, price := range p.Prices {
+			if price.MachineType == machineType && price.Region == r && price.Hourly > 0 {
+				return price.Hourly, true
+			}
+		}
+	}
+
+	if cpus == 0 {
+		return 0, false
+	}
+	for _, r := range []string{region, ""} {
+		for _, price := range p.Prices {
+			if price.MachineType == "" && price.Region == r && (price.VCPUHourly > 0 || price.MemoryGBHourly > 0) {
+				return float64(cpus)*price.VCPUHourly + float64(memoryMB)/1024*price.MemoryGBHourly, true
+			}
+		}
+	}
+
+	return 0, false
+}
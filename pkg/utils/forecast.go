@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"log"
+	"time"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+)
+
+// CapacityMachineMemory takes the capacity of a GCE metric from the memory of
+// the machine type of the instance
+const CapacityMachineMemory = "machineMemory"
+
+// ForecastConf projects the metrics with a capacity on the charts and in the
+// reports of Ranges. Method is linear or holtWinters, Level is the share of
+// the capacity whose projected date is reported and HorizonDays how far ahead
+// it is looked for.
+type ForecastConf struct {
+	RangeSet    `yaml:",inline"`
+	Method      string  `yaml:"method"`
+	Level       float64 `yaml:"level"`
+	HorizonDays int     `yaml:"horizonDays"`
+}
+
+func (c *Conf) loadForecast() {
+	f := &c.Forecast
+	f.loadRanges("Forecast")
+	if f.Method == "" {
+		f.Method = analysis.ForecastLinear
+	}
+	if f.Level == 0 {
+		f.Level = 0.9
+	}
+	if f.HorizonDays == 0 {
+		f.HorizonDays = 90
+	}
+
+	if f.Method != analysis.ForecastLinear && f.Method != analysis.ForecastHoltWinters {
+		log.Fatalf("Forecast: unknown method %q, expect %s or %s", f.Method, analysis.ForecastLinear, analysis.ForecastHoltWinters)
+	}
+	if f.Level <= 0 || f.Level > 1 {
+		log.Fatalf("Forecast: expect 0 < level <= 1, got %g", f.Level)
+	}
+}
+
+func (f ForecastConf) Horizon() time.Duration {
+	return time.Duration(f.HorizonDays) * 24 * time.Hour
+}
+
+// Project the series by the method over the horizon
+func (f ForecastConf) Project(xValues []time.Time, yValues []float64) (analysis.Forecast, bool) {
+	step := analysis.Step(xValues)
+	if step == 0 {
+		return analysis.Forecast{}, false
+	}
+
+	count := int(f.Horizon() / step)
+	if f.Method == analysis.ForecastHoltWinters {
+		return analysis.HoltWintersForecast(xValues, yValues, count)
+	}
+
+	return analysis.LinearForecast(xValues, yValues, count)
+}
@@ -2,16 +2,47 @@ package utils
 
 import "fmt"
 
-func CPUValueFormatter(v interface{}) string {
-	typed, _ := v.(float64)
-	unit := "ms/s"
+const (
+	UnitCPU            = "cpu"
+	UnitBytes          = "bytes"
+	UnitBytesPerSecond = "bytes_per_second"
+	UnitIOPS           = "iops"
+	UnitPercent        = "percent"
+	UnitRatio          = "ratio"
+	UnitCores          = "cores"
+)
 
-	if typed > 1000 {
-		typed = typed / 1000
-		unit = " s/s"
+type ValueFormatter func(v interface{}) string
+
+var valueFormatters = map[string]ValueFormatter{
+	UnitCPU:            CPUValueFormatter,
+	UnitBytes:          MemoryValueFormatter,
+	UnitBytesPerSecond: BytesPerSecondValueFormatter,
+	UnitIOPS:           IOPSValueFormatter,
+	UnitPercent:        PercentValueFormatter,
+	UnitRatio:          RatioValueFormatter,
+	UnitCores:          CoresValueFormatter,
+}
+
+// Unknown units fall back to plain numbers
+func GetValueFormatter(unit string) ValueFormatter {
+	if formatter, ok := valueFormatters[unit]; ok {
+		return formatter
 	}
 
-	return fmt.Sprintf("+%6.2f%s", typed, unit)
+	return NumberValueFormatter
+}
+
+func NumberValueFormatter(v interface{}) string {
+	typed, _ := v.(float64)
+
+	return fmt.Sprintf("+%8.2f", typed)
+}
+
+// CPU usage time aligned with ALIGN_RATE is CPU seconds per second, i.e.
+// cores
+func CPUValueFormatter(v interface{}) string {
+	return CoresValueFormatter(v)
 }
 
 func MemoryValueFormatter(v interface{}) string {
@@ -38,3 +69,53 @@ func MemoryValueFormatter(v interface{}) string {
 
 	return fmt.Sprintf("+%8.2f%s", typed, unit)
 }
+
+func BytesPerSecondValueFormatter(v interface{}) string {
+	typed, _ := v.(float64)
+	unit := "  B/s"
+
+	// KB/s
+	if typed > 1000 {
+		typed = typed / 1024
+		unit = " KB/s"
+	}
+
+	// MB/s
+	if typed > 1000 {
+		typed = typed / 1024
+		unit = " MB/s"
+	}
+
+	// GB/s
+	if typed > 1000 {
+		typed = typed / 1024
+		unit = " GB/s"
+	}
+
+	return fmt.Sprintf("+%8.2f%s", typed, unit)
+}
+
+func IOPSValueFormatter(v interface{}) string {
+	typed, _ := v.(float64)
+
+	return fmt.Sprintf("+%8.2f IOPS", typed)
+}
+
+func PercentValueFormatter(v interface{}) string {
+	typed, _ := v.(float64)
+
+	return fmt.Sprintf("+%6.2f%%", typed)
+}
+
+// 0.0 - 1.0 as percent
+func RatioValueFormatter(v interface{}) string {
+	typed, _ := v.(float64)
+
+	return fmt.Sprintf("+%6.2f%%", typed*100)
+}
+
+func CoresValueFormatter(v interface{}) string {
+	typed, _ := v.(float64)
+
+	return fmt.Sprintf("+%6.3f cores", typed)
+}
@@ -0,0 +1,31 @@
+package utils
+
+import "log"
+
+// HeatmapConf adds heatmaps of Metrics by day of the week and hour of the
+// day to the reports of Ranges: one of every chapter, e.g. the GCE instances
+// of the project, and with InstancePages one page per instance.
+type HeatmapConf struct {
+	RangeSet      `yaml:",inline"`
+	Metrics       []string `yaml:"metrics"`
+	InstancePages bool     `yaml:"instancePages"`
+}
+
+func (c *Conf) loadHeatmaps() {
+	h := &c.Heatmaps
+	h.loadRanges("Heatmaps")
+	if _, ok := c.Metric("cpu_usage_time"); h.Metrics == nil && ok {
+		h.Metrics = []string{"cpu_usage_time"}
+	}
+
+	for _, name := range h.Metrics {
+		if _, ok := c.Metric(name); !ok {
+			log.Fatalf("Heatmaps: unknown metric %q", name)
+		}
+	}
+}
+
+// Of tells whether a metric has heatmaps
+func (h HeatmapConf) Of(metricName string) bool {
+	return contains(h.Metrics, metricName)
+}
@@ -0,0 +1,57 @@
+package utils
+
+// ProjectScope restricts the reported projects. IDs is an explicit project
+// list, Folders and Organizations keep the projects below one of them at any
+// depth and Labels are selectors (key=value, or key for any value) every
+// project must match. An empty scope reports every project.
+type ProjectScope struct {
+	IDs           []string `yaml:"ids"`
+	Folders       []string `yaml:"folders"`
+	Organizations []string `yaml:"organizations"`
+	Labels        []string `yaml:"labels"`
+}
+
+// NeedsAncestry tells whether Match needs the ancestors of a project
+func (s ProjectScope) NeedsAncestry() bool {
+	return len(s.Folders) > 0 || len(s.Organizations) > 0
+}
+
+// Match tells whether a project is in the scope, and why not. Ancestors are
+// resource names, e.g. folders/123 or organizations/456.
+func (s ProjectScope) Match(projectID string, labels map[string]string, ancestors []string) (bool, string) {
+	if len(s.IDs) > 0 && !contains(s.IDs, projectID) {
+		return false, "not in the project list"
+	}
+	if len(s.Labels) > 0 && !matchAllLabels(s.Labels, labels) {
+		return false, "labels do not match"
+	}
+
+	if s.NeedsAncestry() {
+		for _, ancestor := range ancestors {
+			for _, folder := range s.Folders {
+				if ancestor == "folders/"+folder {
+					return true, ""
+				}
+			}
+			for _, organization := range s.Organizations {
+				if ancestor == "organizations/"+organization {
+					return true, ""
+				}
+			}
+		}
+
+		return false, "not under the given folders or organizations"
+	}
+
+	return true, ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"log"
+
+	"stackdriver-monitoring-simple-reporter/pkg/period"
+)
+
+// RangeSet is the data ranges whose reports have a feature, monthly by default
+type RangeSet struct {
+	Ranges []string `yaml:"ranges"`
+}
+
+// Default the ranges and check them, feature names the feature in errors
+func (r *RangeSet) loadRanges(feature string) {
+	if r.Ranges == nil {
+		r.Ranges = []string{period.Monthly}
+	}
+
+	for _, dataRange := range r.Ranges {
+		if !period.Valid(dataRange) {
+			log.Fatalf("%s: unknown data range %q", feature, dataRange)
+		}
+	}
+}
+
+// Enabled tells whether the reports of a data range have the feature
+func (r RangeSet) Enabled(dataRange string) bool {
+	return contains(r.Ranges, dataRange)
+}
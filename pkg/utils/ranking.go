@@ -0,0 +1,49 @@
+package utils
+
+import "log"
+
+const (
+	RankByMean = "mean"
+	RankByP95  = "p95"
+)
+
+// RankingConf adds an overview page after the cover which ranks the top and
+// bottom Count GCE instances by the RankBy statistic of the CPU and memory
+// metrics. TopDetailsOnly leaves out the chart pages of the instances outside
+// the top Count.
+type RankingConf struct {
+	Disabled       bool   `yaml:"disabled"`
+	Count          int    `yaml:"count"`
+	RankBy         string `yaml:"rankBy"`
+	CPUMetric      string `yaml:"cpuMetric"`
+	MemoryMetric   string `yaml:"memoryMetric"`
+	TopDetailsOnly bool   `yaml:"topDetailsOnly"`
+}
+
+func (c *Conf) loadRanking() {
+	r := &c.Ranking
+	if r.Count == 0 {
+		r.Count = 10
+	}
+	if r.RankBy == "" {
+		r.RankBy = RankByP95
+	}
+	if r.CPUMetric == "" {
+		r.CPUMetric = "cpu_usage_time"
+	}
+	if r.MemoryMetric == "" {
+		r.MemoryMetric = "memory_bytes_used"
+	}
+
+	if r.Count < 0 {
+		log.Fatalf("Ranking: expect a positive count, got %d", r.Count)
+	}
+	if r.RankBy != RankByMean && r.RankBy != RankByP95 {
+		log.Fatalf("Ranking: unknown rankBy %q, expect %s or %s", r.RankBy, RankByMean, RankByP95)
+	}
+}
+
+// Metrics ranked, in the order of the page
+func (r RankingConf) Metrics() []string {
+	return []string{r.CPUMetric, r.MemoryMetric}
+}
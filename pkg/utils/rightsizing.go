@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"log"
+
+	"stackdriver-monitoring-simple-reporter/pkg/analysis"
+)
+
+// RightsizingConf adds a rightsizing chapter to the reports of Ranges. The
+// CPU metric is in cores (usage_time aligned as a rate) and the memory metric
+// in bytes. An instance is upsized when a p95 utilization is above
+// UpsizeAbove, downsized when both are below DownsizeBelow, and the suggested
+// size puts the p95 at Target.
+type RightsizingConf struct {
+	RangeSet      `yaml:",inline"`
+	CPUMetric     string  `yaml:"cpuMetric"`
+	MemoryMetric  string  `yaml:"memoryMetric"`
+	UpsizeAbove   float64 `yaml:"upsizeAbove"`
+	DownsizeBelow float64 `yaml:"downsizeBelow"`
+	Target        float64 `yaml:"target"`
+}
+
+func (c *Conf) loadRightsizing() {
+	r := &c.Rightsizing
+	r.loadRanges("Rightsizing")
+	if r.CPUMetric == "" {
+		r.CPUMetric = "cpu_usage_time"
+	}
+	if r.MemoryMetric == "" {
+		r.MemoryMetric = "memory_bytes_used"
+	}
+	if r.UpsizeAbove == 0 {
+		r.UpsizeAbove = 0.8
+	}
+	if r.DownsizeBelow == 0 {
+		r.DownsizeBelow = 0.3
+	}
+	if r.Target == 0 {
+		r.Target = 0.6
+	}
+
+	if !(r.DownsizeBelow < r.Target && r.Target < r.UpsizeAbove) {
+		log.Fatalf("Rightsizing: expect downsizeBelow < target < upsizeAbove, got %g, %g, %g", r.DownsizeBelow, r.Target, r.UpsizeAbove)
+	}
+}
+
+func (r RightsizingConf) Thresholds() analysis.Thresholds {
+	return analysis.Thresholds{
+		UpsizeAbove:   r.UpsizeAbove,
+		DownsizeBelow: r.DownsizeBelow,
+		Target:        r.Target,
+	}
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// InstanceRules match GCE instances by label selectors (key=value, or key
+// for any value), name regular expressions and zones.
+type InstanceRules struct {
+	Labels []string `yaml:"labels"`
+	Names  []string `yaml:"names"`
+	Zones  []string `yaml:"zones"`
+	names  []*regexp.Regexp
+}
+
+// InstanceSelection picks the instances of a project which are reported. An
+// instance is included when it has every include label, matches one of the
+// include names and is in one of the include zones, empty rules match any
+// instance. Matching any exclude rule drops it. A selection without Project
+// applies to the projects without their own.
+type InstanceSelection struct {
+	Project string        `yaml:"project"`
+	Include InstanceRules `yaml:"include"`
+	Exclude InstanceRules `yaml:"exclude"`
+}
+
+func (c *Conf) loadSelections() {
+	projects := make(map[string]bool)
+	for i := range c.Selections {
+		s := &c.Selections[i]
+		if projects[s.Project] {
+			log.Fatalf("Selection of project %q is given twice", s.Project)
+		}
+		projects[s.Project] = true
+
+		s.Include.compileNames(s.Project)
+		s.Exclude.compileNames(s.Project)
+	}
+}
+
+// Name patterns are compiled once, an invalid one is a config error
+func (r *InstanceRules) compileNames(project string) {
+	r.names = make([]*regexp.Regexp, len(r.Names))
+	for i, name := range r.Names {
+		pattern, err := regexp.Compile(name)
+		if err != nil {
+			log.Fatalf("Selection of project %q: invalid name pattern %q: %v", project, name, err)
+		}
+		r.names[i] = pattern
+	}
+}
+
+type Selections []InstanceSelection
+
+// Of returns the selection of a project, the one without Project when the
+// project has none
+func (selections Selections) Of(projectID string) (InstanceSelection, bool) {
+	var fallback InstanceSelection
+	found := false
+
+	for _, s := range selections {
+		if s.Project == projectID {
+			return s, true
+		}
+		if s.Project == "" {
+			fallback = s
+			found = true
+		}
+	}
+
+	return fallback, found
+}
+
+func (s InstanceSelection) Match(name, zone string, labels map[string]string) bool {
+	if len(s.Include.Labels) > 0 && !matchAllLabels(s.Include.Labels, labels) {
+		return false
+	}
+	if len(s.Include.Names) > 0 && !matchAnyName(s.Include.names, name) {
+		return false
+	}
+	if len(s.Include.Zones) > 0 && !matchAnyZone(s.Include.Zones, zone) {
+		return false
+	}
+
+	if matchAnyLabel(s.Exclude.Labels, labels) || matchAnyName(s.Exclude.names, name) || matchAnyZone(s.Exclude.Zones, zone) {
+		return false
+	}
+
+	return true
+}
+
+// Rules describes the selection, one line for include and one for exclude
+func (s InstanceSelection) Rules() (rules []string) {
+	if include := s.Include.describe(); include != "" {
+		rules = append(rules, "Include instances with "+include)
+	}
+	if exclude := s.Exclude.describe(); exclude != "" {
+		rules = append(rules, "Exclude instances with "+exclude)
+	}
+
+	return
+}
+
+// e.g. label env=prod, name ~ ^web-, zone asia-east1-a
+func (r InstanceRules) describe() string {
+	var parts []string
+	if len(r.Labels) > 0 {
+		parts = append(parts, "label "+strings.Join(r.Labels, ", "))
+	}
+	if len(r.Names) > 0 {
+		parts = append(parts, "name ~ "+strings.Join(r.Names, " | "))
+	}
+	if len(r.Zones) > 0 {
+		parts = append(parts, "zone "+strings.Join(r.Zones, ", "))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func matchLabel(selector string, labels map[string]string) bool {
+	if idx := strings.Index(selector, "="); idx >= 0 {
+		value, ok := labels[selector[:idx]]
+		return ok && value == selector[idx+1:]
+	}
+
+	_, ok := labels[selector]
+	return ok
+}
+
+func matchAllLabels(selectors []string, labels map[string]string) bool {
+	for _, selector := range selectors {
+		if !matchLabel(selector, labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchAnyLabel(selectors []string, labels map[string]string) bool {
+	for _, selector := range selectors {
+		if matchLabel(selector, labels) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAnyName(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAnyZone(zones []string, zone string) bool {
+	for _, z := range zones {
+		if z == zone {
+			return true
+		}
+	}
+
+	return false
+}